@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/auth"
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/models"
+	"github.com/arhsxro/platform-go-challenge/storage"
+
+	"github.com/gorilla/mux"
+)
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Validates the request, the fields are named after the JSON ones
+func (request createAPIKeyRequest) validate(now time.Time) []models.FieldError {
+	var fields []models.FieldError
+	if strings.TrimSpace(request.Name) == "" {
+		fields = append(fields, models.FieldError{Field: "name", Message: "is required"})
+	}
+	if len(request.Scopes) == 0 {
+		fields = append(fields, models.FieldError{Field: "scopes", Message: "at least one scope is required"})
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(auth.ValidScopes, scope) {
+			fields = append(fields, models.FieldError{Field: "scopes", Message: "must be one of " + strings.Join(auth.ValidScopes, ", ")})
+			break
+		}
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		fields = append(fields, models.FieldError{Field: "expires_at", Message: "must be in the future"})
+	}
+	return fields
+}
+
+// Body of a created key, the key is only ever returned here
+type createAPIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+type apiKeysResponse struct {
+	Items []models.APIKey `json:"items"`
+}
+
+func (api *API) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := api.requestContext(r)
+	defer cancel()
+
+	logger := logging.FromContext(ctx)
+	var request createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.Info("invalid request payload", slog.Any("error", err))
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if fields := request.validate(time.Now()); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+
+	key, token, err := auth.NewAPIKey(strings.TrimSpace(request.Name), request.Scopes, request.ExpiresAt)
+	if err != nil {
+		logger.Error("error on creating the api key", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := api.apiKeys.CreateAPIKey(ctx, key); err != nil {
+		logger.Error("error on executing the query", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("created api key", slog.String("key_id", key.ID), slog.String("name", key.Name))
+
+	if err := WriteJSON(w, http.StatusCreated, createAPIKeyResponse{APIKey: key, Key: token}); err != nil {
+		logger.Error("error writing the json", slog.Any("error", err))
+	}
+}
+
+func (api *API) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := api.requestContext(r)
+	defer cancel()
+
+	logger := logging.FromContext(ctx)
+	keys, err := api.apiKeys.ListAPIKeys(ctx)
+	if err != nil {
+		logger.Error("error on executing the query", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+
+	if err := WriteJSON(w, http.StatusOK, apiKeysResponse{Items: keys}); err != nil {
+		logger.Error("error writing the json", slog.Any("error", err))
+	}
+}
+
+func (api *API) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := api.requestContext(r)
+	defer cancel()
+
+	logger := logging.FromContext(ctx)
+	keyID := mux.Vars(r)["key_id"]
+	err := api.apiKeys.RevokeAPIKey(ctx, keyID)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "api key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("error on executing the query", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("revoked api key", slog.String("key_id", keyID))
+
+	w.WriteHeader(http.StatusOK)
+}
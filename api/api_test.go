@@ -5,58 +5,92 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/arhsxro/platform-go-challenge/auth"
+	"github.com/arhsxro/platform-go-challenge/logging"
 	"github.com/arhsxro/platform-go-challenge/models"
+	"github.com/arhsxro/platform-go-challenge/ratelimit"
+	"github.com/arhsxro/platform-go-challenge/storage"
+	"github.com/arhsxro/platform-go-challenge/utils"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var testAddedAt = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
 type MockStore struct {
-	GetUserFavoritesFunc  func(ctx context.Context, userID, filterType string, page, pageSize int) ([]models.Asset, error)
-	AddFavoriteFunc       func(ctx context.Context, userID string, asset models.Asset) error
-	RemoveFavoriteFunc    func(ctx context.Context, userID, assetId string) error
-	UpdateDescriptionFunc func(ctx context.Context, userID, assetID, newDescription string) error
+	GetUserFavoritesFunc   func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error)
+	CountUserFavoritesFunc func(ctx context.Context, userID string, opts storage.ListOptions) (int, error)
+	AddFavoriteFunc        func(ctx context.Context, userID string, asset models.Asset) error
+	AddFavoritesFunc       func(ctx context.Context, userID string, assets []models.Asset) ([]string, error)
+	RemoveFavoriteFunc     func(ctx context.Context, userID, assetId string) error
+	UpdateDescriptionFunc  func(ctx context.Context, userID, assetID, newDescription string) error
+	RemoveFavoritesFunc    func(ctx context.Context, userID string, assetIDs []string) ([]string, error)
+	UpdateDescriptionsFunc func(ctx context.Context, userID string, updates []models.DescriptionUpdate) ([]string, error)
+	PingFunc               func(ctx context.Context) error
 }
 
-func (m *MockStore) GetUserFavorites(ctx context.Context, userID, filterType string, page, pageSize int) ([]models.Asset, error) {
+func (m *MockStore) GetUserFavorites(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
 	if m.GetUserFavoritesFunc != nil {
-		return m.GetUserFavoritesFunc(ctx, userID, filterType, page, pageSize)
+		return m.GetUserFavoritesFunc(ctx, userID, opts)
 	}
-	assets := []models.Asset{
-		{ID: "1", Type: "Chart", Description: "Test Asset 1", Data: []byte(`{"title": "Chart 1"}`)},
-		{ID: "2", Type: "Chart", Description: "Test Asset 2", Data: []byte(`{"text": "Insight 2"}`)},
+	favorites := []models.Favorite{
+		{Asset: models.Asset{ID: "1", Type: "Chart", Description: "Test Asset 1", Data: []byte(`{"title": "Chart 1"}`)}, AddedAt: testAddedAt},
+		{Asset: models.Asset{ID: "2", Type: "Chart", Description: "Test Asset 2", Data: []byte(`{"text": "Insight 2"}`)}, AddedAt: testAddedAt},
 	}
-	return assets, nil
+	return storage.FavoritesPage{Favorites: favorites}, nil
 }
 
-func (m *MockStore) GetUserFavoritesInvalidType(ctx context.Context, userID, filterType string, page, pageSize int) ([]models.Asset, error) {
-	if filterType != "" && !isValidAssetType(filterType) {
-		return nil, errors.New("invalid asset type")
+func (m *MockStore) GetUserFavoritesInvalidType(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+	for _, assetType := range opts.Types {
+		if !isValidAssetType(string(assetType)) {
+			return storage.FavoritesPage{}, fmt.Errorf("%w %q", storage.ErrInvalidAssetType, assetType)
+		}
 	}
 
-	return []models.Asset{}, nil
+	return storage.FavoritesPage{}, nil
 }
 
-func (m *MockStore) GetUserFavoritesTimeout(ctx context.Context, userID, filterType string, page, pageSize int) ([]models.Asset, error) {
+func (m *MockStore) GetUserFavoritesTimeout(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
 	time.Sleep(5 * time.Second)
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return storage.FavoritesPage{}, ctx.Err()
 	default:
-		assets := []models.Asset{
-			{ID: "1", Type: "Chart", Description: "Test Asset 1", Data: []byte(`{"title": "Chart 1"}`)},
-			{ID: "2", Type: "Chart", Description: "Test Asset 2", Data: []byte(`{"text": "Insight 2"}`)},
+		favorites := []models.Favorite{
+			{Asset: models.Asset{ID: "1", Type: "Chart", Description: "Test Asset 1", Data: []byte(`{"title": "Chart 1"}`)}, AddedAt: testAddedAt},
+			{Asset: models.Asset{ID: "2", Type: "Chart", Description: "Test Asset 2", Data: []byte(`{"text": "Insight 2"}`)}, AddedAt: testAddedAt},
 		}
-		return assets, nil
+		return storage.FavoritesPage{Favorites: favorites}, nil
 	}
 }
 
-func (m *MockStore) GetUserFavoritesQueryFailed(ctx context.Context, userID, filterType string, page, pageSize int) ([]models.Asset, error) {
-	return nil, errors.New("database error: maximum connections reached")
+func (m *MockStore) GetUserFavoritesQueryFailed(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+	return storage.FavoritesPage{}, errors.New("database error: maximum connections reached")
+}
+
+func (m *MockStore) CountUserFavorites(ctx context.Context, userID string, opts storage.ListOptions) (int, error) {
+	if m.CountUserFavoritesFunc != nil {
+		return m.CountUserFavoritesFunc(ctx, userID, opts)
+	}
+	return 2, nil
 }
 
 func (m *MockStore) AddFavorite(ctx context.Context, userID string, asset models.Asset) error {
@@ -66,6 +100,17 @@ func (m *MockStore) AddFavorite(ctx context.Context, userID string, asset models
 	return nil
 }
 
+func (m *MockStore) AddFavorites(ctx context.Context, userID string, assets []models.Asset) ([]string, error) {
+	if m.AddFavoritesFunc != nil {
+		return m.AddFavoritesFunc(ctx, userID, assets)
+	}
+	added := make([]string, len(assets))
+	for i, asset := range assets {
+		added[i] = asset.ID
+	}
+	return added, nil
+}
+
 func (m *MockStore) AddFavoriteTimeout(ctx context.Context, userID string, asset models.Asset) error {
 	time.Sleep(5 * time.Second)
 	select {
@@ -123,6 +168,31 @@ func (m *MockStore) UpdateDescriptionQueryFailed(ctx context.Context, userID, as
 	return errors.New("database error: maximum connections reached")
 }
 
+func (m *MockStore) RemoveFavorites(ctx context.Context, userID string, assetIDs []string) ([]string, error) {
+	if m.RemoveFavoritesFunc != nil {
+		return m.RemoveFavoritesFunc(ctx, userID, assetIDs)
+	}
+	return assetIDs, nil
+}
+
+func (m *MockStore) UpdateDescriptions(ctx context.Context, userID string, updates []models.DescriptionUpdate) ([]string, error) {
+	if m.UpdateDescriptionsFunc != nil {
+		return m.UpdateDescriptionsFunc(ctx, userID, updates)
+	}
+	updated := make([]string, len(updates))
+	for i, update := range updates {
+		updated[i] = update.ID
+	}
+	return updated, nil
+}
+
+func (m *MockStore) Ping(ctx context.Context) error {
+	if m.PingFunc != nil {
+		return m.PingFunc(ctx)
+	}
+	return nil
+}
+
 func (m *MockStore) Close() error {
 
 	return nil
@@ -158,7 +228,7 @@ func TestHandleGetFavorites_ValidRequestWithFilter(t *testing.T) {
 
 	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"), "content type is not JSON")
 
-	expectedBody := `[{"id":"1","type":"Chart","description":"Test Asset 1","data":{"title": "Chart 1"}},{"id":"2","type":"Chart","description":"Test Asset 2","data":{"text": "Insight 2"}}]`
+	expectedBody := `{"items":[{"id":"1","type":"Chart","description":"Test Asset 1","data":{"title": "Chart 1"},"added_at":"2024-07-01T12:00:00Z"},{"id":"2","type":"Chart","description":"Test Asset 2","data":{"text": "Insight 2"},"added_at":"2024-07-01T12:00:00Z"}],"has_more":false,"total":2,"page":1,"page_size":10,"total_pages":1}`
 	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
 }
 
@@ -181,7 +251,7 @@ func TestHandleGetFavorites_ValidRequestWithoutFilter(t *testing.T) {
 
 	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"), "content type is not JSON")
 
-	expectedBody := `[{"id":"1","type":"Chart","description":"Test Asset 1","data":{"title": "Chart 1"}},{"id":"2","type":"Chart","description":"Test Asset 2","data":{"text": "Insight 2"}}]`
+	expectedBody := `{"items":[{"id":"1","type":"Chart","description":"Test Asset 1","data":{"title": "Chart 1"},"added_at":"2024-07-01T12:00:00Z"},{"id":"2","type":"Chart","description":"Test Asset 2","data":{"text": "Insight 2"},"added_at":"2024-07-01T12:00:00Z"}],"has_more":false,"total":2,"page":1,"page_size":10,"total_pages":1}`
 	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
 }
 
@@ -204,7 +274,43 @@ func TestHandleGetFavorites_InvalidAssetType(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
 
-	assert.Equal(t, "invalid asset type\n", rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `invalid asset type "InvalidType"`)
+}
+
+func TestHandleGetFavorites_MultipleTypes(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	var received []models.AssetType
+	mockStore.GetUserFavoritesFunc = func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+		received = opts.Types
+		return storage.FavoritesPage{}, nil
+	}
+
+	for _, query := range []string{"type=Chart,Insight", "type=Chart&type=Insight", "type=Chart&type=Insight,Chart"} {
+		req, err := http.NewRequest("GET", "/favorites/test_user?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match for %s", query)
+		assert.Equal(t, []models.AssetType{models.ChartType, models.InsightType}, received, "types do not match for %s", query)
+	}
+
+	req, err := http.NewRequest("GET", "/favorites/test_user?type=Chart,Map", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
 }
 
 func TestHandleGetFavorites_ContextRequestTimeout(t *testing.T) {
@@ -253,239 +359,342 @@ func TestHandleGetFavorites_QueryFailed(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rr.Code, "status codes do not match")
 }
 
-//Tests for HandleAddFavorite
-
-func TestHandleAddFavorites_NormalFlow(t *testing.T) {
+func TestHandleGetFavorites_Cursor(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	requestBody := models.Asset{
-		ID:          "insight2",
-		Type:        "Insight",
-		Description: "An insightful text",
-		Data:        json.RawMessage(`{"text": "only 15% of the people in Greece watch One Piece"}`),
+	cursor := storage.Cursor{AddedAt: testAddedAt, AssetID: "1", Type: "Chart", Description: "Test Asset 1", Sort: "added_at,asset_id"}
+	mockStore.GetUserFavoritesFunc = func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+		assert.Equal(t, &cursor, opts.After, "cursor was not passed to the store")
+		assert.Equal(t, 1, opts.PageSize)
+		favorite := models.Favorite{Asset: models.Asset{ID: "2", Type: "Chart", Description: "Test Asset 2", Data: []byte(`{"title": "Chart 2"}`)}, AddedAt: testAddedAt}
+		return storage.FavoritesPage{Favorites: []models.Favorite{favorite}, HasMore: true, Next: storage.CursorOf(favorite, storage.ListOptions{}.Order())}, nil
 	}
 
-	body, err := json.Marshal(requestBody)
+	req, err := http.NewRequest("GET", "/favorites/test_user?pageSize=1&cursor="+cursor.Encode(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+
+	response := decodeFavoritesResponse(t, rr)
+	assert.True(t, response.HasMore)
+	assert.Equal(t, storage.Cursor{AddedAt: testAddedAt, AssetID: "2", Type: "Chart", Description: "Test Asset 2", Sort: "added_at,asset_id"}.Encode(), response.NextCursor)
+}
+
+func TestHandleGetFavorites_InvalidCursor(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	req, err := http.NewRequest("GET", "/favorites/test_user?cursor=not-a-cursor", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	router.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite)
-
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusCreated, rr.Code, "status codes do not match")
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
+
+	assert.Equal(t, "invalid cursor\n", rr.Body.String())
 }
 
-func TestHandleAddFavorites_InvalidPayload(t *testing.T) {
+func TestHandleGetFavorites_Sort(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	invalidRequestBody := `{"id":123, "type": 456, "description": 789, "data": "not a valid json"}`
+	var receivedSort []storage.SortKey
+	mockStore.GetUserFavoritesFunc = func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+		receivedSort = opts.Sort
+		return storage.FavoritesPage{}, nil
+	}
 
-	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBufferString(invalidRequestBody))
+	req, err := http.NewRequest("GET", "/favorites/test_user?sort=-added_at,type", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	router.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite)
-
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+	assert.Equal(t, []storage.SortKey{{Field: storage.SortByAddedAt, Desc: true}, {Field: storage.SortByType}}, receivedSort)
+}
 
-	assert.Equal(t, "Invalid request payload\n", rr.Body.String())
+func TestHandleGetFavorites_InvalidSort(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	for _, query := range []string{"sort=data", "sort=type%3BDROP%20TABLE%20favorites", "sort=type,-type"} {
+		req, err := http.NewRequest("GET", "/favorites/test_user?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
 
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match for %s", query)
+	}
 }
 
-func TestHandleAddFavorites_ContextTimeout(t *testing.T) {
+func TestHandleGetFavorites_Search(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	mockStore.AddFavoriteFunc = mockStore.AddFavoriteTimeout
-
-	requestBody := models.Asset{
-		ID:          "insight2",
-		Type:        "Insight",
-		Description: "An insightful text",
-		Data:        json.RawMessage(`{"text": "only 15% of the people in Greece watch One Piece"}`),
+	var received storage.ListOptions
+	mockStore.GetUserFavoritesFunc = func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+		received = opts
+		return storage.FavoritesPage{}, nil
 	}
 
-	body, err := json.Marshal(requestBody)
+	req, err := http.NewRequest("GET", "/favorites/test_user?q=%22social+media%22+-tiktok&sort=-relevance", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+	assert.Equal(t, `"social media" -tiktok`, received.Search)
+	assert.Equal(t, []storage.SortKey{{Field: storage.SortByRelevance, Desc: true}}, received.Sort)
+}
+
+func TestHandleGetFavorites_RelevanceWithoutSearch(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	req, err := http.NewRequest("GET", "/favorites/test_user?sort=-relevance", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	req.Header.Set("Content-Type", "application/json")
-	router.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite)
 
 	rr := httptest.NewRecorder()
-	router.ServeHTTP(rr, req.WithContext(ctx))
+	router.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusGatewayTimeout, rr.Code, "status code is not Gateway Timeout")
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
 }
 
-func TestHandleAddFavorites_QueryFailed(t *testing.T) {
+func TestHandleGetFavorites_AudienceFilters(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	mockStore.AddFavoriteFunc = mockStore.AddFavoriteQueryFailed
-
-	requestBody := models.Asset{
-		ID:          "insight2",
-		Type:        "Insight",
-		Description: "An insightful text",
-		Data:        json.RawMessage(`{"text": "only 15% of the people in Greece watch One Piece"}`),
-	}
-
-	body, err := json.Marshal(requestBody)
-	if err != nil {
-		t.Fatal(err)
+	var received []storage.AudienceFilter
+	mockStore.GetUserFavoritesFunc = func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+		received = opts.Audience
+		return storage.FavoritesPage{}, nil
 	}
 
-	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBuffer(body))
+	req, err := http.NewRequest("GET", "/favorites/test_user?audience.gender=Female&audience.socialMediaHours%5Bgte%5D=3", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	router.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite)
-
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusInternalServerError, rr.Code, "status codes do not match")
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+	assert.Equal(t, []storage.AudienceFilter{
+		{Field: storage.AudienceGender, Operator: storage.OpEq, Value: "Female"},
+		{Field: storage.AudienceSocialMediaHours, Operator: storage.OpGte, Value: 3.0},
+	}, received)
 }
 
-//Tests for RemoveFavorite Handler
+func TestHandleGetFavorites_InvalidAudienceFilter(t *testing.T) {
 
-func TestHandleRemoveFavorites_NormalFlow(t *testing.T) {
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	for _, query := range []string{
+		"audience.income=100",
+		"audience.gender%5Bgt%5D=Female",
+		"audience.socialMediaHours%5Blike%5D=3",
+		"audience.socialMediaHours=many",
+		"audience.socialMediaHours%5Bgt%5D=NaN",
+		"audience.gender%27%20OR%201=1",
+	} {
+		req, err := http.NewRequest("GET", "/favorites/test_user?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match for %s", query)
+	}
+}
+
+func TestHandleGetFavorites_CursorOfAnotherSort(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	req, err := http.NewRequest("DELETE", "/favorites/test_user/test_asset", nil)
+	favorite := models.Favorite{Asset: models.Asset{ID: "1", Type: "Chart", Description: "Test Asset 1"}, AddedAt: testAddedAt}
+	cursor := storage.CursorOf(favorite, []storage.SortKey{{Field: storage.SortByType}})
+
+	req, err := http.NewRequest("GET", "/favorites/test_user?sort=-added_at&cursor="+cursor.Encode(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleRemoveFavorite)
-
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
+	assert.Equal(t, "cursor does not match the sort order\n", rr.Body.String())
 }
 
-func TestHandleRemoveFavorites_ContextTimeout(t *testing.T) {
+func TestHandleGetFavorites_PaginationLinks(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	mockStore.RemoveFavoriteFunc = mockStore.RemoveFavoriteTimeout
+	mockStore.GetUserFavoritesFunc = func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+		favorite := models.Favorite{Asset: models.Asset{ID: "3", Type: "Chart", Description: "Test Asset 3", Data: []byte(`{"title": "Chart 3"}`)}, AddedAt: testAddedAt}
+		return storage.FavoritesPage{Favorites: []models.Favorite{favorite}, HasMore: true, Next: storage.CursorOf(favorite, storage.ListOptions{}.Order())}, nil
+	}
+	mockStore.CountUserFavoritesFunc = func(ctx context.Context, userID string, opts storage.ListOptions) (int, error) {
+		return 7, nil
+	}
 
-	req, err := http.NewRequest("DELETE", "/favorites/test_user/test_asset", nil)
+	req, err := http.NewRequest("GET", "/favorites/test_user?type=Chart&page=2&pageSize=2", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
 
-	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleRemoveFavorite)
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
 
-	rr := httptest.NewRecorder()
-	router.ServeHTTP(rr, req.WithContext(ctx))
+	expectedLinks := `</favorites/test_user?page=1&pageSize=2&type=Chart>; rel="first", ` +
+		`</favorites/test_user?page=1&pageSize=2&type=Chart>; rel="prev", ` +
+		`</favorites/test_user?page=3&pageSize=2&type=Chart>; rel="next", ` +
+		`</favorites/test_user?page=4&pageSize=2&type=Chart>; rel="last"`
+	assert.Equal(t, expectedLinks, rr.Header().Get("Link"))
 
-	assert.Equal(t, http.StatusGatewayTimeout, rr.Code, "status codes do not match")
+	response := decodeFavoritesResponse(t, rr)
+	assert.Equal(t, 7, *response.Total)
+	assert.Equal(t, 2, response.Page)
+	assert.Equal(t, 2, response.PageSize)
+	assert.Equal(t, 4, *response.TotalPages)
+
+	// The links carry the page size the page was read with
+	req, err = http.NewRequest("GET", "/favorites/test_user?pageSize=500", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+
+	expectedLinks = `</favorites/test_user?page=1&pageSize=100>; rel="first", ` +
+		`</favorites/test_user?page=2&pageSize=100>; rel="next", ` +
+		`</favorites/test_user?page=1&pageSize=100>; rel="last"`
+	assert.Equal(t, expectedLinks, rr.Header().Get("Link"))
+	assert.Equal(t, 100, decodeFavoritesResponse(t, rr).PageSize)
 }
 
-func TestHandleRemoveFavorites_QueryFailed(t *testing.T) {
+func TestHandleGetFavorites_WithoutCount(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	mockStore.RemoveFavoriteFunc = mockStore.RemoveFavoriteQueryFailed
+	mockStore.CountUserFavoritesFunc = func(ctx context.Context, userID string, opts storage.ListOptions) (int, error) {
+		t.Fatal("favorites should not be counted")
+		return 0, nil
+	}
 
-	req, err := http.NewRequest("DELETE", "/favorites/test_user/test_asset", nil)
+	req, err := http.NewRequest("GET", "/favorites/test_user?count=false", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleRemoveFavorite)
-
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusInternalServerError, rr.Code, "status codes do not match")
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+
+	expectedBody := `{"items":[{"id":"1","type":"Chart","description":"Test Asset 1","data":{"title": "Chart 1"},"added_at":"2024-07-01T12:00:00Z"},{"id":"2","type":"Chart","description":"Test Asset 2","data":{"text": "Insight 2"},"added_at":"2024-07-01T12:00:00Z"}],"has_more":false,"page":1,"page_size":10}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+	assert.Equal(t, `</favorites/test_user?count=false&page=1>; rel="first"`, rr.Header().Get("Link"))
 }
 
-//Tests for EditDesciption Handler
+//Tests for HandleAddFavorite
 
-func TestHandleEditDescription_NormalFlow(t *testing.T) {
+func TestHandleAddFavorites_NormalFlow(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	requestBody := `{"description": "Updated description for the asset"}`
-	req, err := http.NewRequest("PUT", "/favorites/test_user/test_asset", bytes.NewBufferString(requestBody))
+	requestBody := models.Asset{
+		ID:          "insight2",
+		Type:        "Insight",
+		Description: "An insightful text",
+		Data:        json.RawMessage(`{"text": "only 15% of the people in Greece watch One Piece"}`),
+	}
+
+	body, err := json.Marshal(requestBody)
 	if err != nil {
 		t.Fatal(err)
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleEditDescription)
+	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	router.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite)
 
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+	assert.Equal(t, http.StatusCreated, rr.Code, "status codes do not match")
 }
 
-func TestHandleEditDescription_InvalidPayload(t *testing.T) {
+func TestHandleAddFavorites_InvalidPayload(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	invalidRequestBody := `{"description": "Updated description for the asset"`
-	req, err := http.NewRequest("PUT", "/favorites/test_user/asset1", bytes.NewBufferString(invalidRequestBody))
+	invalidRequestBody := `{"id":123, "type": 456, "description": 789, "data": "not a valid json"}`
+
+	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBufferString(invalidRequestBody))
 	if err != nil {
 		t.Fatal(err)
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleEditDescription)
+	req.Header.Set("Content-Type", "application/json")
+	router.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite)
 
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
@@ -493,25 +702,38 @@ func TestHandleEditDescription_InvalidPayload(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
 
 	assert.Equal(t, "Invalid request payload\n", rr.Body.String())
+
 }
 
-func TestHandleEditDescription_ContextTimeout(t *testing.T) {
+func TestHandleAddFavorites_ContextTimeout(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	mockStore.UpdateDescriptionFunc = mockStore.UpdateDescriptionTimeout
+	mockStore.AddFavoriteFunc = mockStore.AddFavoriteTimeout
 
-	requestBody := `{"description": "Updated description for the asset"}`
-	req, err := http.NewRequest("PUT", "/favorites/test_user/test_asset", bytes.NewBufferString(requestBody))
+	requestBody := models.Asset{
+		ID:          "insight2",
+		Type:        "Insight",
+		Description: "An insightful text",
+		Data:        json.RawMessage(`{"text": "only 15% of the people in Greece watch One Piece"}`),
+	}
+
+	body, err := json.Marshal(requestBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBuffer(body))
 	if err != nil {
 		t.Fatal(err)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleEditDescription)
+	req.Header.Set("Content-Type", "application/json")
+	router.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite)
 
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req.WithContext(ctx))
@@ -519,17 +741,647 @@ func TestHandleEditDescription_ContextTimeout(t *testing.T) {
 	assert.Equal(t, http.StatusGatewayTimeout, rr.Code, "status code is not Gateway Timeout")
 }
 
-func TestHandleEditDescription_QueryFailed(t *testing.T) {
+func TestHandleAddFavorites_QueryFailed(t *testing.T) {
 
 	mockStore := &MockStore{}
 	api := InitApi(mockStore)
 	router := api.InitRoutes()
 
-	mockStore.UpdateDescriptionFunc = mockStore.UpdateDescriptionQueryFailed
+	mockStore.AddFavoriteFunc = mockStore.AddFavoriteQueryFailed
 
-	requestBody := `{"description": "Updated description for the asset"}`
-	req, err := http.NewRequest("PUT", "/favorites/test_user/test_asset", bytes.NewBufferString(requestBody))
-	if err != nil {
+	requestBody := models.Asset{
+		ID:          "insight2",
+		Type:        "Insight",
+		Description: "An insightful text",
+		Data:        json.RawMessage(`{"text": "only 15% of the people in Greece watch One Piece"}`),
+	}
+
+	body, err := json.Marshal(requestBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	router.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code, "status codes do not match")
+}
+
+func TestHandleAddFavorites_InvalidAssetData(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	mockStore.AddFavoriteFunc = func(ctx context.Context, userID string, asset models.Asset) error {
+		t.Fatal("store should not be called for an invalid asset")
+		return nil
+	}
+
+	invalidRequestBody := `{"id": "chart9", "type": "Chart", "description": "A chart", "data": {"title": "", "axisTitle": "Axis", "data": "1,2,3"}}`
+
+	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBufferString(invalidRequestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "status codes do not match")
+
+	expectedBody := `{"error":"validation failed","fields":[{"field":"data.data","message":"must be of type []float64"}]}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+}
+
+func TestHandleAddFavorites_InvalidAssetType(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	invalidRequestBody := `{"id": "map1", "type": "Map", "description": "A map", "data": {"text": "a map"}}`
+
+	req, err := http.NewRequest("POST", "/favorites/test_user", bytes.NewBufferString(invalidRequestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "status codes do not match")
+
+	expectedBody := `{"error":"validation failed","fields":[{"field":"type","message":"must be one of Chart, Insight, Audience"}]}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+}
+
+//Tests for AddMultipleFavorites Handler
+
+func TestHandleAddMultipleFavorites_NormalFlow(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	requestBody := `[
+		{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "only 15% of the people in Greece watch One Piece"}},
+		{"id": "audience4", "type": "Audience", "description": "An audience", "data": {"gender": "Female", "birthCountry": "Greece", "ageGroup": "18-24", "socialMediaHours": 4, "purchasesLastMonth": 2}}
+	]`
+
+	req, err := http.NewRequest("POST", "/multiple/favorites/test_user", bytes.NewBufferString(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code, "status codes do not match")
+
+	expectedBody := `{
+		"summary": {"total": 2, "created": 2, "already_existed": 0, "invalid": 0, "failed": 0},
+		"results": [
+			{"index": 0, "id": "insight4", "status": "created"},
+			{"index": 1, "id": "audience4", "status": "created"}
+		]
+	}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+}
+
+func TestHandleAddMultipleFavorites_InvalidAsset(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	var added []string
+	mockStore.AddFavoriteFunc = func(ctx context.Context, userID string, asset models.Asset) error {
+		added = append(added, asset.ID)
+		return nil
+	}
+
+	requestBody := `[
+		{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "only 15% of the people in Greece watch One Piece"}},
+		{"id": "audience4", "type": "Audience", "description": "An audience", "data": {"gender": "Female", "birthCountry": "Greece", "ageGroup": "35-18", "socialMediaHours": 4, "purchasesLastMonth": 2, "income": 1000}}
+	]`
+
+	req, err := http.NewRequest("POST", "/multiple/favorites/test_user", bytes.NewBufferString(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, "status codes do not match")
+	assert.Equal(t, []string{"insight4"}, added, "the valid assets are added")
+
+	expectedBody := `{
+		"summary": {"total": 2, "created": 1, "already_existed": 0, "invalid": 1, "failed": 0},
+		"results": [
+			{"index": 0, "id": "insight4", "status": "created"},
+			{"index": 1, "id": "audience4", "status": "invalid", "error": "validation failed", "fields": [{"field": "data.income", "message": "is not allowed"}]}
+		]
+	}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+}
+
+func TestHandleAddMultipleFavorites_QueryFailed(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore, WithRetryPolicy(utils.RetryPolicy{MaxAttempts: 1}))
+	router := api.InitRoutes()
+
+	mockStore.AddFavoriteFunc = func(ctx context.Context, userID string, asset models.Asset) error {
+		if asset.ID == "insight5" {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+
+	requestBody := `[
+		{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "a text"}},
+		{"id": "insight5", "type": "Insight", "description": "A text", "data": {"text": "another text"}}
+	]`
+	rr := serve(t, router, "POST", "/multiple/favorites/test_user", requestBody)
+
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, "status codes do not match")
+
+	expectedBody := `{
+		"summary": {"total": 2, "created": 1, "already_existed": 0, "invalid": 0, "failed": 1},
+		"results": [
+			{"index": 0, "id": "insight4", "status": "created"},
+			{"index": 1, "id": "insight5", "status": "failed", "error": "connection reset"}
+		]
+	}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+}
+
+func TestHandleAddMultipleFavorites_AlreadyExists(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	var calls atomic.Int32
+	mockStore.AddFavoriteFunc = func(ctx context.Context, userID string, asset models.Asset) error {
+		calls.Add(1)
+		if asset.ID == "insight5" {
+			return storage.ErrAlreadyExists
+		}
+		return nil
+	}
+
+	requestBody := `[
+		{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "a text"}},
+		{"id": "insight5", "type": "Insight", "description": "A text", "data": {"text": "another text"}}
+	]`
+	rr := serve(t, router, "POST", "/multiple/favorites/test_user", requestBody)
+
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, "status codes do not match")
+	assert.Equal(t, int32(2), calls.Load(), "an existing favorite is not retried")
+
+	expectedBody := `{
+		"summary": {"total": 2, "created": 1, "already_existed": 1, "invalid": 0, "failed": 0},
+		"results": [
+			{"index": 0, "id": "insight4", "status": "created"},
+			{"index": 1, "id": "insight5", "status": "already_existed", "error": "already a favorite of the user"}
+		]
+	}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+}
+
+func TestHandleAddMultipleFavorites_BatchTooLarge(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore, WithBulkLimits(1, 1))
+	router := api.InitRoutes()
+
+	mockStore.AddFavoriteFunc = func(ctx context.Context, userID string, asset models.Asset) error {
+		t.Fatal("store should not be called when the batch is too large")
+		return nil
+	}
+
+	requestBody := `[
+		{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "a text"}},
+		{"id": "insight5", "type": "Insight", "description": "A text", "data": {"text": "another text"}}
+	]`
+	rr := serve(t, router, "POST", "/multiple/favorites/test_user", requestBody)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "status codes do not match")
+
+	rr = serve(t, router, "POST", "/multiple/favorites/test_user?atomic=true", requestBody)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "status codes do not match")
+
+	// The body is not read past the first item over the limit
+	truncated := `[{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "a text"}}, {"id": "insight5", "da`
+	rr = serve(t, router, "POST", "/multiple/favorites/test_user", truncated)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "status codes do not match")
+
+	rr = serve(t, router, "DELETE", "/multiple/favorites/test_user", `["insight4", "insight5", "insigh`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "status codes do not match")
+
+	rr = serve(t, router, "PUT", "/multiple/favorites/test_user", `[{"id": "insight4", "description": "A text"}, {"id": "insigh`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "status codes do not match")
+}
+
+func TestHandleAddMultipleFavorites_QueuedWorkCanceled(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore,
+		WithBulkLimits(10, 1),
+		WithTimeouts(Timeouts{Default: 50 * time.Millisecond}),
+	)
+	router := api.InitRoutes()
+
+	var calls atomic.Int32
+	mockStore.AddFavoriteFunc = func(ctx context.Context, userID string, asset models.Asset) error {
+		calls.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	requestBody := `[
+		{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "a text"}},
+		{"id": "insight5", "type": "Insight", "description": "A text", "data": {"text": "another text"}},
+		{"id": "insight6", "type": "Insight", "description": "A text", "data": {"text": "a third text"}}
+	]`
+	rr := serve(t, router, "POST", "/multiple/favorites/test_user", requestBody)
+
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, "status codes do not match")
+	assert.Equal(t, int32(1), calls.Load(), "the queued assets were added after the deadline")
+	var response bulkResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]int{"total": 3, "created": 0, "already_existed": 0, "invalid": 0, "failed": 3}, response.Summary)
+	for _, result := range response.Results {
+		assert.Equal(t, "request timed out", result.Error)
+	}
+}
+
+func TestHandleAddMultipleFavorites_Atomic(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore, WithRetryPolicy(utils.RetryPolicy{MaxAttempts: 1}))
+	router := api.InitRoutes()
+
+	var batches [][]models.Asset
+	var storeErr error
+	mockStore.AddFavoriteFunc = func(ctx context.Context, userID string, asset models.Asset) error {
+		t.Fatal("an atomic batch should be added at once")
+		return nil
+	}
+	mockStore.AddFavoritesFunc = func(ctx context.Context, userID string, assets []models.Asset) ([]string, error) {
+		batches = append(batches, assets)
+		if storeErr != nil {
+			return nil, storeErr
+		}
+		// insight5 already was a favorite
+		return []string{"insight4"}, nil
+	}
+
+	requestBody := `[
+		{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "a text"}},
+		{"id": "insight5", "type": "Insight", "description": "A text", "data": {"text": "another text"}}
+	]`
+	rr := serve(t, router, "POST", "/multiple/favorites/test_user?atomic=true", requestBody)
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, "status codes do not match")
+	assert.Equal(t, []string{"insight4", "insight5"}, []string{batches[0][0].ID, batches[0][1].ID})
+	expectedBody := `{
+		"summary": {"total": 2, "created": 1, "already_existed": 1, "invalid": 0, "failed": 0},
+		"results": [
+			{"index": 0, "id": "insight4", "status": "created"},
+			{"index": 1, "id": "insight5", "status": "already_existed", "error": "already a favorite of the user"}
+		]
+	}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+
+	// Nothing is added when one asset fails
+	storeErr = errors.New("connection reset")
+	rr = serve(t, router, "POST", "/multiple/favorites/test_user?atomic=true", requestBody)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code, "status codes do not match")
+
+	// Nor when one is invalid
+	invalidBody := `[
+		{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "a text"}},
+		{"id": "insight5", "type": "Insight", "description": "A text", "data": {}}
+	]`
+	rr = serve(t, router, "POST", "/multiple/favorites/test_user?atomic=true", invalidBody)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "status codes do not match")
+	assert.JSONEq(t, `{"error":"validation failed","fields":[{"field":"[1].data.text","message":"is required"}]}`, rr.Body.String())
+	assert.Len(t, batches, 2, "the store was called with an invalid batch")
+
+	rr = serve(t, router, "POST", "/multiple/favorites/test_user?atomic=yes", requestBody)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
+}
+
+func TestHandleAddMultipleFavorites_RepeatedAsset(t *testing.T) {
+
+	router := InitApi(storage.NewMemoryStore()).InitRoutes()
+
+	requestBody := `[
+		{"id": "insight4", "type": "Insight", "description": "A text", "data": {"text": "a text"}},
+		{"id": "insight5", "type": "Insight", "description": "A text", "data": {"text": "another text"}},
+		{"id": "insight4", "type": "Insight", "description": "Another text", "data": {"text": "a text"}}
+	]`
+	expectedBody := `{
+		"summary": {"total": 3, "created": 2, "already_existed": 1, "invalid": 0, "failed": 0},
+		"results": [
+			{"index": 0, "id": "insight4", "status": "created"},
+			{"index": 1, "id": "insight5", "status": "created"},
+			{"index": 2, "id": "insight4", "status": "already_existed", "error": "already a favorite of the user"}
+		]
+	}`
+	// Both modes add the first one and report the others the same way
+	for _, url := range []string{"/multiple/favorites/user1", "/multiple/favorites/user2?atomic=true"} {
+		rr := serve(t, router, "POST", url, requestBody)
+		assert.Equal(t, http.StatusMultiStatus, rr.Code, "status codes do not match for %s", url)
+		assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON for %s", url)
+	}
+}
+
+func TestHandleRemoveMultipleFavorites(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore, WithRetryPolicy(utils.RetryPolicy{MaxAttempts: 1}))
+	router := api.InitRoutes()
+
+	var received []string
+	var storeErr error
+	mockStore.RemoveFavoritesFunc = func(ctx context.Context, userID string, assetIDs []string) ([]string, error) {
+		received = assetIDs
+		if storeErr != nil {
+			return nil, storeErr
+		}
+		return []string{"chart1"}, nil
+	}
+
+	rr := serve(t, router, "DELETE", "/multiple/favorites/test_user", `["chart1", "", "insight1"]`)
+
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, "status codes do not match")
+	assert.Equal(t, []string{"chart1", "insight1"}, received, "the invalid ids are not sent to the store")
+	expectedBody := `{
+		"summary": {"total": 3, "removed": 1, "not_found": 1, "invalid": 1, "failed": 0},
+		"results": [
+			{"index": 0, "id": "chart1", "status": "removed"},
+			{"index": 1, "id": "", "status": "invalid", "error": "validation failed", "fields": [{"field": "id", "message": "is required"}]},
+			{"index": 2, "id": "insight1", "status": "not_found", "error": "not a favorite of the user"}
+		]
+	}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+
+	rr = serve(t, router, "DELETE", "/multiple/favorites/test_user", `["chart1"]`)
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+
+	// The batch is a single statement, it fails as a whole
+	storeErr = errors.New("connection reset")
+	rr = serve(t, router, "DELETE", "/multiple/favorites/test_user", `["chart1", "insight1"]`)
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, "status codes do not match")
+	assert.Contains(t, rr.Body.String(), `"summary":{"failed":2,"invalid":0,"not_found":0,"removed":0,"total":2}`)
+
+	rr = serve(t, router, "DELETE", "/multiple/favorites/test_user", `{"id": "chart1"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
+}
+
+func TestHandleEditMultipleDescriptions(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore, WithBulkLimits(3, 1))
+	router := api.InitRoutes()
+
+	var received []models.DescriptionUpdate
+	mockStore.UpdateDescriptionsFunc = func(ctx context.Context, userID string, updates []models.DescriptionUpdate) ([]string, error) {
+		received = updates
+		return []string{"chart1", "insight1"}, nil
+	}
+
+	requestBody := `[{"id": "chart1", "description": "My chart"}, {"id": "insight1", "description": "My insight"}, {"id": "missing", "description": "Nothing"}]`
+	rr := serve(t, router, "PUT", "/multiple/favorites/test_user", requestBody)
+
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, "status codes do not match")
+	assert.Equal(t, []models.DescriptionUpdate{{ID: "chart1", Description: "My chart"}, {ID: "insight1", Description: "My insight"}, {ID: "missing", Description: "Nothing"}}, received)
+	expectedBody := `{
+		"summary": {"total": 3, "updated": 2, "not_found": 1, "invalid": 0, "failed": 0},
+		"results": [
+			{"index": 0, "id": "chart1", "status": "updated"},
+			{"index": 1, "id": "insight1", "status": "updated"},
+			{"index": 2, "id": "missing", "status": "not_found", "error": "not a favorite of the user"}
+		]
+	}`
+	assert.JSONEq(t, expectedBody, rr.Body.String(), "response body does not match expected JSON")
+
+	rr = serve(t, router, "PUT", "/multiple/favorites/test_user", `[{"id": "chart1"}, {"id": "chart2"}, {"id": "chart3"}, {"id": "chart4"}]`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "status codes do not match")
+}
+
+func TestStorageErrors(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	var calls int
+	mockStore.AddFavoriteFunc = func(ctx context.Context, userID string, asset models.Asset) error {
+		calls++
+		return storage.ErrAlreadyExists
+	}
+	mockStore.RemoveFavoriteFunc = func(ctx context.Context, userID, assetID string) error {
+		calls++
+		return storage.ErrNotFound
+	}
+	mockStore.UpdateDescriptionFunc = func(ctx context.Context, userID, assetID, newDescription string) error {
+		calls++
+		return fmt.Errorf("updating %s: %w", assetID, storage.ErrNotFound)
+	}
+	mockStore.GetUserFavoritesFunc = func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+		calls++
+		return storage.FavoritesPage{}, fmt.Errorf("%w \"Map\"", storage.ErrInvalidAssetType)
+	}
+
+	tests := []struct {
+		method, url, body string
+		status            int
+		message           string
+	}{
+		{"POST", "/favorites/test_user", `{"id": "insight1", "type": "Insight", "description": "A text", "data": {"text": "a text"}}`, http.StatusConflict, "Favorite already exists"},
+		{"DELETE", "/favorites/test_user/missing", "", http.StatusNotFound, "Favorite not found"},
+		{"PUT", "/favorites/test_user/missing", `{"description": "New"}`, http.StatusNotFound, "Favorite not found"},
+		{"GET", "/favorites/test_user", "", http.StatusBadRequest, `invalid asset type "Map"`},
+	}
+	for _, tt := range tests {
+		calls = 0
+		rr := serve(t, router, tt.method, tt.url, tt.body)
+		assert.Equal(t, tt.status, rr.Code, "%s %s", tt.method, tt.url)
+		assert.Equal(t, tt.message+"\n", rr.Body.String(), "%s %s", tt.method, tt.url)
+		assert.Equal(t, 1, calls, "%s %s was retried", tt.method, tt.url)
+	}
+}
+
+//Tests for RemoveFavorite Handler
+
+func TestHandleRemoveFavorites_NormalFlow(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	req, err := http.NewRequest("DELETE", "/favorites/test_user/test_asset", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleRemoveFavorite)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+}
+
+func TestHandleRemoveFavorites_ContextTimeout(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	mockStore.RemoveFavoriteFunc = mockStore.RemoveFavoriteTimeout
+
+	req, err := http.NewRequest("DELETE", "/favorites/test_user/test_asset", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleRemoveFavorite)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req.WithContext(ctx))
+
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code, "status codes do not match")
+}
+
+func TestHandleRemoveFavorites_QueryFailed(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	mockStore.RemoveFavoriteFunc = mockStore.RemoveFavoriteQueryFailed
+
+	req, err := http.NewRequest("DELETE", "/favorites/test_user/test_asset", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleRemoveFavorite)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code, "status codes do not match")
+}
+
+//Tests for EditDesciption Handler
+
+func TestHandleEditDescription_NormalFlow(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	requestBody := `{"description": "Updated description for the asset"}`
+	req, err := http.NewRequest("PUT", "/favorites/test_user/test_asset", bytes.NewBufferString(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleEditDescription)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "status codes do not match")
+}
+
+func TestHandleEditDescription_InvalidPayload(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	invalidRequestBody := `{"description": "Updated description for the asset"`
+	req, err := http.NewRequest("PUT", "/favorites/test_user/asset1", bytes.NewBufferString(invalidRequestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleEditDescription)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "status codes do not match")
+
+	assert.Equal(t, "Invalid request payload\n", rr.Body.String())
+}
+
+func TestHandleEditDescription_ContextTimeout(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	mockStore.UpdateDescriptionFunc = mockStore.UpdateDescriptionTimeout
+
+	requestBody := `{"description": "Updated description for the asset"}`
+	req, err := http.NewRequest("PUT", "/favorites/test_user/test_asset", bytes.NewBufferString(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleEditDescription)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req.WithContext(ctx))
+
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code, "status code is not Gateway Timeout")
+}
+
+func TestHandleEditDescription_QueryFailed(t *testing.T) {
+
+	mockStore := &MockStore{}
+	api := InitApi(mockStore)
+	router := api.InitRoutes()
+
+	mockStore.UpdateDescriptionFunc = mockStore.UpdateDescriptionQueryFailed
+
+	requestBody := `{"description": "Updated description for the asset"}`
+	req, err := http.NewRequest("PUT", "/favorites/test_user/test_asset", bytes.NewBufferString(requestBody))
+	if err != nil {
 		t.Fatal(err)
 	}
 
@@ -540,3 +1392,601 @@ func TestHandleEditDescription_QueryFailed(t *testing.T) {
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code, "status codes do not match")
 }
+
+//End to end tests against the in-memory store
+
+// Sends a request to the router and returns the recorded response
+func serve(t *testing.T, router http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func decodeFavoritesResponse(t *testing.T, rr *httptest.ResponseRecorder) favoritesResponse {
+	t.Helper()
+	var response favoritesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func decodeFavorites(t *testing.T, rr *httptest.ResponseRecorder) []models.Favorite {
+	t.Helper()
+	return decodeFavoritesResponse(t, rr).Items
+}
+
+func favoriteIDs(favorites []models.Favorite) []string {
+	ids := make([]string, len(favorites))
+	for i, favorite := range favorites {
+		ids[i] = favorite.ID
+	}
+	return ids
+}
+
+func TestMemoryStore_SharedAssetAcrossUsers(t *testing.T) {
+	router := InitApi(storage.NewMemoryStore()).InitRoutes()
+
+	chart := `{"id": "chart1", "type": "Chart", "description": "A test chart", "data": {"title": "Test Chart", "axisTitle": "Test Axis", "data": [0, 1, 2]}}`
+	assert.Equal(t, http.StatusCreated, serve(t, router, "POST", "/favorites/user1", chart).Code)
+	assert.Equal(t, http.StatusCreated, serve(t, router, "POST", "/favorites/user2", chart).Code)
+
+	// Each user has their own description of the shared asset
+	rr := serve(t, router, "PUT", "/favorites/user2/chart1", `{"description": "My chart"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = serve(t, router, "GET", "/favorites/user1", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	user1Favorites := decodeFavorites(t, rr)
+	if assert.Len(t, user1Favorites, 1) {
+		assert.Equal(t, "A test chart", user1Favorites[0].Description)
+	}
+
+	rr = serve(t, router, "GET", "/favorites/user2", "")
+	user2Favorites := decodeFavorites(t, rr)
+	if assert.Len(t, user2Favorites, 1) {
+		assert.Equal(t, "My chart", user2Favorites[0].Description)
+	}
+
+	// Removing the favorite of one user leaves the asset in place for the other
+	assert.Equal(t, http.StatusOK, serve(t, router, "DELETE", "/favorites/user1/chart1", "").Code)
+
+	assert.Empty(t, decodeFavorites(t, serve(t, router, "GET", "/favorites/user1", "")))
+	assert.Equal(t, []string{"chart1"}, favoriteIDs(decodeFavorites(t, serve(t, router, "GET", "/favorites/user2", ""))))
+}
+
+func TestMemoryStore_FilterAndPagination(t *testing.T) {
+	router := InitApi(storage.NewMemoryStore()).InitRoutes()
+
+	assets := `[
+		{"id": "insight1", "type": "Insight", "description": "A text", "data": {"text": "first"}},
+		{"id": "insight2", "type": "Insight", "description": "A text", "data": {"text": "second"}},
+		{"id": "insight3", "type": "Insight", "description": "A text", "data": {"text": "third"}},
+		{"id": "chart1", "type": "Chart", "description": "A chart", "data": {"title": "Test Chart", "data": [1]}}
+	]`
+	assert.Equal(t, http.StatusCreated, serve(t, router, "POST", "/multiple/favorites/user1", assets).Code)
+
+	rr := serve(t, router, "GET", "/favorites/user1?type=Insight&page=1&pageSize=2", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	firstPage := decodeFavorites(t, rr)
+	assert.Len(t, firstPage, 2)
+
+	rr = serve(t, router, "GET", "/favorites/user1?type=Insight&page=2&pageSize=2", "")
+	secondPage := decodeFavorites(t, rr)
+	assert.Len(t, secondPage, 1)
+
+	assert.ElementsMatch(t, []string{"insight1", "insight2", "insight3"}, append(favoriteIDs(firstPage), favoriteIDs(secondPage)...))
+
+	rr = serve(t, router, "GET", "/favorites/user1?type=Chart", "")
+	assert.Equal(t, []string{"chart1"}, favoriteIDs(decodeFavorites(t, rr)))
+
+	response := decodeFavoritesResponse(t, serve(t, router, "GET", "/favorites/user1?pageSize=3", ""))
+	assert.Equal(t, 4, *response.Total)
+	assert.Equal(t, 2, *response.TotalPages)
+
+	// Following next_cursor walks through every insight once
+	var walked []string
+	url := "/favorites/user1?type=Insight&pageSize=2"
+	for {
+		response := decodeFavoritesResponse(t, serve(t, router, "GET", url, ""))
+		walked = append(walked, favoriteIDs(response.Items)...)
+		if !response.HasMore {
+			assert.Empty(t, response.NextCursor)
+			break
+		}
+		url = "/favorites/user1?type=Insight&pageSize=2&cursor=" + response.NextCursor
+	}
+	assert.ElementsMatch(t, []string{"insight1", "insight2", "insight3"}, walked)
+
+	rr = serve(t, router, "GET", "/favorites/user1?type=Map", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestMemoryStore_Search(t *testing.T) {
+	router := InitApi(storage.NewMemoryStore()).InitRoutes()
+
+	assets := `[
+		{"id": "insight1", "type": "Insight", "description": "A text", "data": {"text": "Half of the users churn"}},
+		{"id": "insight2", "type": "Insight", "description": "A text", "data": {"text": "Churn churn churn"}},
+		{"id": "chart1", "type": "Chart", "description": "A chart", "data": {"title": "Sales", "data": [1]}}
+	]`
+	assert.Equal(t, http.StatusCreated, serve(t, router, "POST", "/multiple/favorites/user1", assets).Code)
+
+	response := decodeFavoritesResponse(t, serve(t, router, "GET", "/favorites/user1?q=churn", ""))
+	assert.Equal(t, []string{"insight2", "insight1"}, favoriteIDs(response.Items))
+	assert.Equal(t, 2, *response.Total)
+	assert.Equal(t, "<b>Churn</b> <b>churn</b> <b>churn</b>", response.Items[0].Snippet)
+
+	// Searching and filtering go together
+	response = decodeFavoritesResponse(t, serve(t, router, "GET", "/favorites/user1?q=churn&type=Chart", ""))
+	assert.Empty(t, response.Items)
+}
+
+func signedToken(t *testing.T, subject, scope string) string {
+	t.Helper()
+	claims := jwt.MapClaims{"sub": subject, "scope": scope, "exp": time.Now().Add(time.Hour).Unix()}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAuthentication(t *testing.T) {
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{HMACSecret: []byte("test-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := InitApi(&MockStore{}, WithAuthenticator(authenticator)).InitRoutes()
+
+	tests := []struct {
+		name          string
+		method, url   string
+		authorization string
+		expected      int
+	}{
+		{"without token", "GET", "/favorites/user1", "", http.StatusUnauthorized},
+		{"other scheme", "GET", "/favorites/user1", "Basic dXNlcjE6cGFzcw==", http.StatusUnauthorized},
+		{"invalid token", "GET", "/favorites/user1", "Bearer not.a.token", http.StatusUnauthorized},
+		{"own favorites", "GET", "/favorites/user1", "Bearer " + signedToken(t, "user1", ""), http.StatusOK},
+		{"favorites of another user", "GET", "/favorites/user2", "Bearer " + signedToken(t, "user1", ""), http.StatusForbidden},
+		{"removing a favorite of another user", "DELETE", "/favorites/user2/asset1", "Bearer " + signedToken(t, "user1", "read"), http.StatusForbidden},
+		{"admin", "DELETE", "/favorites/user2/asset1", "Bearer " + signedToken(t, "user1", "admin"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, tt.expected, rr.Code, tt.name)
+		if tt.expected == http.StatusUnauthorized {
+			assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"), tt.name)
+		}
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	store := storage.NewMemoryStore()
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{HMACSecret: []byte("test-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := InitApi(store,
+		WithAuthenticator(auth.Chain{authenticator, auth.NewAPIKeyAuthenticator(store)}),
+		WithAPIKeys(store),
+	).InitRoutes()
+
+	request := func(method, url, authorization, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", authorization)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	admin := "Bearer " + signedToken(t, "admin1", "admin")
+
+	// Only admins manage keys
+	assert.Equal(t, http.StatusForbidden, request("GET", "/admin/api-keys", "Bearer "+signedToken(t, "user1", ""), "").Code)
+
+	rr := request("POST", "/admin/api-keys", admin, `{"name": "", "scopes": ["favorites:delete"]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = request("POST", "/admin/api-keys", admin, `{"name": "exporter", "scopes": ["favorites:read"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created struct {
+		ID   string `json:"id"`
+		Key  string `json:"key"`
+		Hash string `json:"secret_hash"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Key)
+	assert.Empty(t, created.Hash, "the hash of the secret was returned")
+	apiKey := "ApiKey " + created.Key
+
+	// A read key reads the favorites of any user but can't change them
+	assert.Equal(t, http.StatusOK, request("GET", "/favorites/user1", apiKey, "").Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/favorites/user2", apiKey, "").Code)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/favorites/user1/asset1", apiKey, "").Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/admin/api-keys", apiKey, "").Code)
+
+	rr = request("GET", "/admin/api-keys", admin, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var list apiKeysResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	if assert.Len(t, list.Items, 1) {
+		assert.Equal(t, created.ID, list.Items[0].ID)
+		assert.NotNil(t, list.Items[0].LastUsedAt)
+	}
+	assert.NotContains(t, rr.Body.String(), created.Key)
+
+	assert.Equal(t, http.StatusOK, request("DELETE", "/admin/api-keys/"+created.ID, admin, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/favorites/user1", apiKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", "/admin/api-keys/missing", admin, "").Code)
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), ratelimit.Rules{
+		Routes: map[string]ratelimit.Limit{"GET /favorites/{user_id}": {Rate: 1.0 / 60, Burst: 2}},
+	})
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{HMACSecret: []byte("test-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := InitApi(&MockStore{}, WithAuthenticator(authenticator), WithRateLimiter(limiter, false)).InitRoutes()
+
+	request := func(method, url, subject string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+signedToken(t, subject, ""))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := request("GET", "/favorites/user1", "user1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=120", rr.Header().Get("RateLimit-Policy"))
+
+	assert.Equal(t, http.StatusOK, request("GET", "/favorites/user1", "user1").Code)
+
+	rr = request("GET", "/favorites/user1", "user1")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+
+	// Other users and routes without a limit are not affected
+	assert.Equal(t, http.StatusOK, request("GET", "/favorites/user2", "user2").Code)
+	rr = request("DELETE", "/favorites/user1/asset1", "user1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimit_Unauthenticated(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), ratelimit.Rules{
+		IP: &ratelimit.Limit{Rate: 1.0 / 60, Burst: 3},
+	})
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{HMACSecret: []byte("test-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := InitApi(&MockStore{}, WithAuthenticator(authenticator), WithRateLimiter(limiter, false)).InitRoutes()
+
+	request := func(remoteAddr, authorization string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/favorites/user1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = remoteAddr
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request("10.0.0.1:1234", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("10.0.0.1:1234", "Bearer wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("10.0.0.1:1234", "ApiKey wrong").Code)
+	rr := request("10.0.0.1:1234", "Bearer "+signedToken(t, "user1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code, "the guesses of the client were not limited")
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+
+	// Other IPs have their own bucket
+	assert.Equal(t, http.StatusOK, request("10.0.0.2:1234", "Bearer "+signedToken(t, "user1", "")).Code)
+}
+
+func TestRateLimit_ByClientIP(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryBackend(), ratelimit.Rules{
+		Routes: map[string]ratelimit.Limit{"GET /favorites/{user_id}": {Rate: 1.0 / 60, Burst: 1}},
+	})
+
+	for _, trustProxy := range []bool{false, true} {
+		router := InitApi(&MockStore{}, WithRateLimiter(limiter, trustProxy)).InitRoutes()
+		request := func(remoteAddr, forwardedFor string) int {
+			req, err := http.NewRequest("GET", "/favorites/user1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.RemoteAddr = remoteAddr
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr.Code
+		}
+
+		if !trustProxy {
+			assert.Equal(t, http.StatusOK, request("10.0.0.1:1234", "192.0.2.1"))
+			assert.Equal(t, http.StatusTooManyRequests, request("10.0.0.1:5678", "192.0.2.2"), "the forwarded address was trusted")
+			assert.Equal(t, http.StatusOK, request("10.0.0.2:1234", ""))
+		} else {
+			assert.Equal(t, http.StatusOK, request("10.0.0.3:1234", "192.0.2.1"))
+			assert.Equal(t, http.StatusTooManyRequests, request("10.0.0.3:1234", "198.51.100.7, 192.0.2.1"), "the client chose its bucket")
+			assert.Equal(t, http.StatusOK, request("10.0.0.3:1234", "192.0.2.1, 192.0.2.2"))
+			assert.Equal(t, http.StatusTooManyRequests, request("10.0.0.4:1234", "192.0.2.2"))
+		}
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, logging.Options{Level: "debug", RedactData: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockStore := &MockStore{
+		AddFavoriteFunc: func(ctx context.Context, userID string, asset models.Asset) error {
+			logging.FromContext(ctx).Info("stored the favorite")
+			return nil
+		},
+	}
+	router := InitApi(mockStore, WithLogger(logger)).InitRoutes()
+
+	body := `{"id": "insight1", "type": "Insight", "description": "A text", "data": {"text": "secret payload"}}`
+	req, err := http.NewRequest("POST", "/favorites/user1", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-ID", "request-1")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "request-1", rr.Header().Get("X-Request-ID"))
+	assert.NotContains(t, logs.String(), "secret payload")
+
+	var lines []map[string]any
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var line map[string]any
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	messages := make([]any, len(lines))
+	for i, line := range lines {
+		messages[i] = line["msg"]
+		assert.Equal(t, "request-1", line["request_id"])
+		assert.Equal(t, "user1", line["user_id"])
+		assert.Equal(t, "POST /favorites/{user_id}", line["route"])
+	}
+	assert.Equal(t, []any{"adding favorite", "stored the favorite", "request served"}, messages)
+	assert.Equal(t, map[string]any{"id": "insight1", "type": "Insight", "description": "A text", "data": logging.Redacted}, lines[0]["asset"])
+	assert.Equal(t, float64(http.StatusCreated), lines[2]["status"])
+	assert.Contains(t, lines[2], "latency_ms")
+}
+
+func TestRequestLogging_GeneratedRequestID(t *testing.T) {
+	router := InitApi(&MockStore{}, WithLogger(slog.New(slog.NewJSONHandler(io.Discard, nil)))).InitRoutes()
+
+	for _, header := range []string{"", "not a request id", strings.Repeat("a", 129)} {
+		req, err := http.NewRequest("GET", "/favorites/user1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Request-ID", header)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Regexp(t, `^[0-9a-f]{32}$`, rr.Header().Get("X-Request-ID"), header)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{HMACSecret: []byte("test-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := InitApi(&MockStore{}, WithAuthenticator(authenticator)).InitRoutes()
+
+	req, err := http.NewRequest("GET", "/favorites/user1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Scrapers are not authenticated
+	req, err = http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `favorites_http_requests_total{method="GET",route="/favorites/{user_id}",status="401"}`)
+	assert.Contains(t, rr.Body.String(), `favorites_http_request_duration_seconds_bucket{method="GET",route="/favorites/{user_id}",status="401",le="0.005"}`)
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	// The first attempt fails, the storage sees the span of the attempt it is called from
+	var attemptSpans []trace.SpanID
+	mockStore := &MockStore{
+		GetUserFavoritesFunc: func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+			attemptSpans = append(attemptSpans, trace.SpanFromContext(ctx).SpanContext().SpanID())
+			if len(attemptSpans) == 1 {
+				return storage.FavoritesPage{}, errors.New("connection reset")
+			}
+			return storage.FavoritesPage{}, nil
+		},
+	}
+	router := InitApi(mockStore, WithLogger(slog.New(slog.NewJSONHandler(io.Discard, nil)))).InitRoutes()
+
+	req, err := http.NewRequest("GET", "/favorites/user1?count=false", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	server := spans[2]
+	assert.Equal(t, "GET /favorites/{user_id}", server.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Contains(t, server.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+
+	for i, attempt := range spans[:2] {
+		assert.Equal(t, "retry attempt", attempt.Name())
+		assert.Equal(t, server.SpanContext().SpanID(), attempt.Parent().SpanID())
+		assert.Equal(t, attempt.SpanContext().SpanID(), attemptSpans[i])
+		assert.Contains(t, attempt.Attributes(), attribute.Int("retry.attempt", i+1))
+	}
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+func TestHealth(t *testing.T) {
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{HMACSecret: []byte("test-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := InitApi(&MockStore{}, WithAuthenticator(authenticator)).InitRoutes()
+
+	// The probes are not authenticated
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, rr.Body.String())
+}
+
+func TestReady(t *testing.T) {
+	pingErr := error(nil)
+	mockStore := &MockStore{PingFunc: func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("no timeout")
+		}
+		return pingErr
+	}}
+	api := InitApi(mockStore, WithReadinessCheck("migrations", func(ctx context.Context) error { return nil }))
+	router := api.InitRoutes()
+
+	ready := func() (int, healthResponse) {
+		req, err := http.NewRequest("GET", "/readyz", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var response healthResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Code, response
+	}
+
+	status, response := ready()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", response.Status)
+	assert.Equal(t, "ok", response.Checks["storage"].Status)
+	assert.Equal(t, "ok", response.Checks["migrations"].Status)
+
+	pingErr = errors.New("connection refused")
+	status, response = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "unavailable", response.Status)
+	assert.Equal(t, checkResult{Status: "failing", Error: "connection refused", LatencyMs: response.Checks["storage"].LatencyMs}, response.Checks["storage"])
+	assert.Equal(t, "ok", response.Checks["migrations"].Status)
+
+	pingErr = nil
+	api.StartShutdown()
+	status, response = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, healthResponse{Status: "shutting_down"}, response)
+}
+
+func TestSettings(t *testing.T) {
+	var received storage.ListOptions
+	var deadline time.Duration
+	mockStore := &MockStore{GetUserFavoritesFunc: func(ctx context.Context, userID string, opts storage.ListOptions) (storage.FavoritesPage, error) {
+		received = opts
+		if d, ok := ctx.Deadline(); ok {
+			deadline = time.Until(d)
+		}
+		return storage.FavoritesPage{}, nil
+	}}
+	router := InitApi(mockStore,
+		WithTimeouts(Timeouts{Default: time.Second, Routes: map[string]time.Duration{"GET /favorites/{user_id}": time.Minute}}),
+		WithPagination(5, 20),
+		WithFeatures(Features{}),
+	).InitRoutes()
+
+	rr := serve(t, router, "GET", "/favorites/user1", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 5, received.PageSize)
+	assert.Greater(t, deadline, 30*time.Second, "the timeout of the route applies")
+
+	rr = serve(t, router, "GET", "/favorites/user1?pageSize=50", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 20, received.PageSize, "the page size is cut to the max")
+
+	rr = serve(t, router, "GET", "/favorites/user1?q=chart", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "search is turned off")
+
+	rr = serve(t, router, "GET", "/metrics", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/arhsxro/platform-go-challenge/auth"
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/storage"
+	"github.com/gorilla/mux"
+)
+
+// Option configures an API created by InitApi
+type Option func(api *API)
+
+// Requires every request to be authenticated, callers may only act on their own favorites
+// unless they have the admin scope
+func WithAuthenticator(authenticator auth.Authenticator) Option {
+	return func(api *API) {
+		api.authenticator = authenticator
+	}
+}
+
+// Adds the admin endpoints managing the API keys, they are only served when authentication is on
+func WithAPIKeys(keys storage.APIKeyStore) Option {
+	return func(api *API) {
+		api.apiKeys = keys
+	}
+}
+
+// Middleware authenticating the caller and checking that it may act on the user_id of the route
+func (api *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
+		principal, err := api.authenticator.Authenticate(r)
+		if errors.Is(err, auth.ErrMissingCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+			logger.Info("authentication failed", slog.Any("error", err))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="favorites", ApiKey realm="favorites"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			logger.Error("error on authenticating the request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if scope := requiredScope(r); !principal.Allows(scope) {
+			logger.Info("missing scope", slog.String("subject", principal.Subject), slog.String("scope", scope))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if userID, ok := mux.Vars(r)["user_id"]; ok && !principal.CanActFor(userID) {
+			logger.Info("not allowed to act for the user", slog.String("subject", principal.Subject))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		// The caller may be a service acting for the user, its logs tell who it was
+		ctx := logging.With(r.Context(), slog.String("subject", principal.Subject))
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(ctx, principal)))
+	})
+}
+
+// Returns the scope a request needs, reading favorites needs read, changing them needs write
+func requiredScope(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/admin/"):
+		return auth.ScopeAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return auth.ScopeRead
+	default:
+		return auth.ScopeWrite
+	}
+}
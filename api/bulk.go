@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/models"
+	"github.com/arhsxro/platform-go-challenge/storage"
+	"github.com/gorilla/mux"
+)
+
+// Outcomes of the items of a batch
+const (
+	bulkCreated  = "created"
+	bulkRemoved  = "removed"
+	bulkUpdated  = "updated"
+	bulkNotFound = "not_found"
+	bulkExisted  = "already_existed"
+	bulkInvalid  = "invalid"
+	bulkFailed   = "failed"
+)
+
+// Outcomes each bulk operation can end with, the first one is its success
+var (
+	addOutcomes    = []string{bulkCreated, bulkExisted, bulkInvalid, bulkFailed}
+	removeOutcomes = []string{bulkRemoved, bulkNotFound, bulkInvalid, bulkFailed}
+	updateOutcomes = []string{bulkUpdated, bulkNotFound, bulkInvalid, bulkFailed}
+)
+
+// Outcome of one item of a batch, index is its position in the request body
+type bulkResult struct {
+	Index  int                 `json:"index"`
+	ID     string              `json:"id"`
+	Status string              `json:"status"`
+	Error  string              `json:"error,omitempty"`
+	Fields []models.FieldError `json:"fields,omitempty"`
+}
+
+// Body of the bulk responses, the summary counts the items of every outcome of the operation along with
+// the total, and the results are in the order of the request body
+type bulkResponse struct {
+	Summary map[string]int `json:"summary"`
+	Results []bulkResult   `json:"results"`
+
+	success string
+}
+
+// Builds the response of a batch from the ids of its items and the errors of the ones that did not succeed,
+// the others ended with the first of the outcomes
+func newBulkResponse(outcomes []string, ids []string, assetErrs []models.AssetError) bulkResponse {
+	response := bulkResponse{
+		Summary: map[string]int{"total": len(ids)},
+		Results: make([]bulkResult, len(ids)),
+		success: outcomes[0],
+	}
+	for i, id := range ids {
+		response.Results[i] = bulkResult{Index: i, ID: id, Status: response.success}
+	}
+	for _, assetErr := range assetErrs {
+		result := &response.Results[assetErr.Index]
+		if fields := validationFields(assetErr.Err); fields != nil {
+			result.Status, result.Error, result.Fields = bulkInvalid, "validation failed", fields
+			continue
+		}
+		switch errorStatus(assetErr.Err) {
+		case http.StatusNotFound:
+			result.Status, result.Error = bulkNotFound, "not a favorite of the user"
+		case http.StatusConflict:
+			result.Status, result.Error = bulkExisted, "already a favorite of the user"
+		case http.StatusGatewayTimeout:
+			result.Status, result.Error = bulkFailed, "request timed out"
+		default:
+			result.Status, result.Error = bulkFailed, assetErr.Err.Error()
+		}
+	}
+
+	for _, outcome := range outcomes {
+		response.Summary[outcome] = 0
+	}
+	for _, result := range response.Results {
+		response.Summary[result.Status]++
+	}
+	return response
+}
+
+// Writes the results of a batch, with status when every item succeeded and 207 otherwise
+func writeBulkResponse(w http.ResponseWriter, r *http.Request, status int, response bulkResponse) {
+	if response.Summary[response.success] != response.Summary["total"] {
+		status = http.StatusMultiStatus
+	}
+	if err := WriteJSON(w, status, response); err != nil {
+		logging.FromContext(r.Context()).Error("error writing the json", slog.Any("error", err))
+	}
+}
+
+// Keeps the first of the assets at the indexes that have the same id, the others are reported as already
+// existing without being stored, so that both modes add an asset given twice once and report it the same way
+func firstOccurrences(assets []models.Asset, indexes []int) ([]int, []models.AssetError) {
+	var first []int
+	var repeated []models.AssetError
+	seen := make(map[string]bool, len(indexes))
+	for _, i := range indexes {
+		if seen[assets[i].ID] {
+			repeated = append(repeated, models.AssetError{Index: i, Asset: assets[i], Err: storage.ErrAlreadyExists})
+			continue
+		}
+		seen[assets[i].ID] = true
+		first = append(first, i)
+	}
+	return first, repeated
+}
+
+func assetIDsOf(assets []models.Asset) []string {
+	ids := make([]string, len(assets))
+	for i, asset := range assets {
+		ids[i] = asset.ID
+	}
+	return ids
+}
+
+var errBatchTooLarge = errors.New("batch too large")
+
+// Decodes the JSON array of the body item by item, it stops at the first item past the max batch size
+// so that a batch too large is refused with 413 without reading the rest of it
+func decodeBatch[T any](api *API, w http.ResponseWriter, r *http.Request) ([]T, bool) {
+	logger := logging.FromContext(r.Context())
+	items, err := readBatch[T](json.NewDecoder(r.Body), api.maxBatchSize)
+	if errors.Is(err, errBatchTooLarge) {
+		logger.Info("batch too large", slog.Int("max_batch_size", api.maxBatchSize))
+		http.Error(w, fmt.Sprintf("A batch may have at most %d items", api.maxBatchSize), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if err != nil {
+		logger.Info("invalid request payload", slog.Any("error", err))
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return nil, false
+	}
+	return items, true
+}
+
+func readBatch[T any](decoder *json.Decoder, maxSize int) ([]T, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	// null is an empty batch, as it is when the whole array is decoded at once
+	if token == nil {
+		return nil, nil
+	}
+	if token != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array, got %v", token)
+	}
+	var items []T
+	for decoder.More() {
+		if len(items) == maxSize {
+			return nil, errBatchTooLarge
+		}
+		var item T
+		if err := decoder.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Removes a batch of favorites of a user, the body is the list of the ids of their assets
+func (api *API) HandleRemoveMultipleFavorites(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := api.requestContext(r)
+	defer cancel()
+
+	logger := logging.FromContext(ctx)
+	userID := mux.Vars(r)["user_id"]
+
+	assetIDs, ok := decodeBatch[string](api, w, r)
+	if !ok {
+		return
+	}
+
+	var assetErrs []models.AssetError
+	var valid []int
+	for i, assetID := range assetIDs {
+		if err := models.ValidateAssetID(assetID); err != nil {
+			assetErrs = append(assetErrs, models.AssetError{Index: i, Asset: models.Asset{ID: assetID}, Err: err})
+			continue
+		}
+		valid = append(valid, i)
+	}
+	ids := make([]string, len(valid))
+	for j, i := range valid {
+		ids[j] = assetIDs[i]
+	}
+
+	logger.Debug("removing favorites", slog.Int("assets", len(ids)))
+	var removed []string
+	err := api.retry(ctx, func(ctx context.Context) error {
+		var err error
+		removed, err = api.db.RemoveFavorites(ctx, userID, ids)
+		return err
+	})
+
+	assetErrs = append(assetErrs, batchErrors(ctx, valid, ids, removed, err, storage.ErrNotFound)...)
+	writeBulkResponse(w, r, http.StatusOK, newBulkResponse(removeOutcomes, assetIDs, assetErrs))
+}
+
+// Updates the descriptions of a batch of favorites of a user, the body is a list of {"id", "description"}
+func (api *API) HandleEditMultipleDescriptions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := api.requestContext(r)
+	defer cancel()
+
+	logger := logging.FromContext(ctx)
+	userID := mux.Vars(r)["user_id"]
+
+	updates, ok := decodeBatch[models.DescriptionUpdate](api, w, r)
+	if !ok {
+		return
+	}
+
+	assetIDs := make([]string, len(updates))
+	var assetErrs []models.AssetError
+	var valid []int
+	for i, update := range updates {
+		assetIDs[i] = update.ID
+		if err := update.Validate(); err != nil {
+			assetErrs = append(assetErrs, models.AssetError{Index: i, Asset: models.Asset{ID: update.ID}, Err: err})
+			continue
+		}
+		valid = append(valid, i)
+	}
+	validUpdates := make([]models.DescriptionUpdate, len(valid))
+	ids := make([]string, len(valid))
+	for j, i := range valid {
+		validUpdates[j], ids[j] = updates[i], updates[i].ID
+	}
+
+	logger.Debug("editing the descriptions", slog.Int("assets", len(validUpdates)))
+	var updated []string
+	err := api.retry(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = api.db.UpdateDescriptions(ctx, userID, validUpdates)
+		return err
+	})
+
+	assetErrs = append(assetErrs, batchErrors(ctx, valid, ids, updated, err, storage.ErrNotFound)...)
+	writeBulkResponse(w, r, http.StatusOK, newBulkResponse(updateOutcomes, assetIDs, assetErrs))
+}
+
+// Returns the errors of the items of a batch stored with a single statement. The items at the indexes
+// have the ids, when the statement failed they all failed, otherwise the ones whose id is not among
+// the done ones failed with notDone.
+func batchErrors(ctx context.Context, indexes []int, ids []string, done []string, err, notDone error) []models.AssetError {
+	logger := logging.FromContext(ctx)
+	if err != nil {
+		if errorStatus(err) == http.StatusGatewayTimeout {
+			logger.Warn("request timed out", slog.Any("error", err))
+		} else {
+			logger.Error("error on executing the query", slog.Any("error", err))
+		}
+	}
+
+	isDone := make(map[string]bool, len(done))
+	for _, id := range done {
+		isDone[id] = true
+	}
+	var assetErrs []models.AssetError
+	for j, i := range indexes {
+		switch {
+		case err != nil:
+			assetErrs = append(assetErrs, models.AssetError{Index: i, Asset: models.Asset{ID: ids[j]}, Err: err})
+		case !isDone[ids[j]]:
+			assetErrs = append(assetErrs, models.AssetError{Index: i, Asset: models.Asset{ID: ids[j]}, Err: notDone})
+		}
+	}
+	return assetErrs
+}
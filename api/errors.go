@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/storage"
+	"github.com/arhsxro/platform-go-challenge/utils"
+)
+
+// Statuses of the errors of the storage, the ones that are not listed are 500
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{context.DeadlineExceeded, http.StatusGatewayTimeout},
+	{storage.ErrNotFound, http.StatusNotFound},
+	{storage.ErrAlreadyExists, http.StatusConflict},
+	{storage.ErrInvalidAssetType, http.StatusBadRequest},
+}
+
+// Returns the status of the response to a request whose storage operation failed with err
+func errorStatus(err error) int {
+	for _, mapping := range errorStatuses {
+		if errors.Is(err, mapping.err) {
+			return mapping.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// Runs a storage operation with the retry policy. The errors saying the request itself is wrong
+// are returned right away, retrying won't change them.
+func (api *API) retry(ctx context.Context, operation func(ctx context.Context) error) error {
+	return api.retryPolicy.Retry(ctx, func(ctx context.Context) error {
+		err := operation(ctx)
+		if status := errorStatus(err); status >= 400 && status < 500 {
+			return utils.Permanent(err)
+		}
+		return err
+	})
+}
+
+// Writes the response of a request whose storage operation failed, with the status the error maps to
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	logger := logging.FromContext(r.Context())
+	status := errorStatus(err)
+	switch status {
+	case http.StatusGatewayTimeout:
+		logger.Warn("request timed out", slog.Any("error", err))
+		http.Error(w, "Request timed out", status)
+	case http.StatusNotFound:
+		logger.Info("favorite not found", slog.Any("error", err))
+		http.Error(w, "Favorite not found", status)
+	case http.StatusConflict:
+		logger.Info("favorite already exists", slog.Any("error", err))
+		http.Error(w, "Favorite already exists", status)
+	case http.StatusInternalServerError:
+		logger.Error("error on executing the query", slog.Any("error", err))
+		http.Error(w, err.Error(), status)
+	default:
+		logger.Info("invalid request", slog.Any("error", err))
+		http.Error(w, err.Error(), status)
+	}
+}
@@ -3,14 +3,19 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
+	"sync/atomic"
 
+	"github.com/arhsxro/platform-go-challenge/auth"
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/metrics"
 	"github.com/arhsxro/platform-go-challenge/models"
+	"github.com/arhsxro/platform-go-challenge/ratelimit"
 	"github.com/arhsxro/platform-go-challenge/storage"
 	"github.com/arhsxro/platform-go-challenge/utils"
 
@@ -19,19 +24,81 @@ import (
 
 type API struct {
 	db storage.Store
+	// Nil when authentication is turned off
+	authenticator auth.Authenticator
+	// Nil when API keys are not managed through the API
+	apiKeys storage.APIKeyStore
+	// Nil when requests are not rate limited
+	rateLimiter *ratelimit.Limiter
+	trustProxy  bool
+	logger      *slog.Logger
+	// Dependencies checked by the readiness probe, by name
+	readinessChecks map[string]ReadinessCheck
+	shuttingDown    atomic.Bool
+
+	timeouts        Timeouts
+	retryPolicy     utils.RetryPolicy
+	defaultPageSize int
+	maxPageSize     int
+	maxBatchSize    int
+	bulkExecutor    utils.Executor
+	features        Features
 }
 
-func InitApi(dbInstance storage.Store) *API {
-	return &API{db: dbInstance}
+func InitApi(dbInstance storage.Store, options ...Option) *API {
+	api := &API{
+		db:              dbInstance,
+		logger:          slog.Default(),
+		readinessChecks: map[string]ReadinessCheck{"storage": dbInstance.Ping},
+		timeouts:        DefaultTimeouts,
+		retryPolicy:     utils.DefaultRetryPolicy,
+		defaultPageSize: 10,
+		maxPageSize:     100,
+		maxBatchSize:    1000,
+		bulkExecutor:    utils.Executor{Concurrency: 8},
+		features:        DefaultFeatures,
+	}
+	for _, option := range options {
+		option(api)
+	}
+	return api
 }
 
 func (api *API) InitRoutes() *mux.Router {
 	router := mux.NewRouter()
-	router.HandleFunc("/favorites/{user_id}", api.HandleGetFavorites).Methods("GET")
-	router.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite).Methods("POST")
-	router.HandleFunc("/multiple/favorites/{user_id}", api.HandleAddMultipleFavorites).Methods("POST")
-	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleRemoveFavorite).Methods("DELETE")
-	router.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleEditDescription).Methods("PUT")
+	// Outside of the API routes, so that the scrapers and the probes are neither authenticated nor rate limited
+	if api.features.Metrics {
+		router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	}
+	router.HandleFunc("/healthz", api.HandleHealth).Methods("GET")
+	router.HandleFunc("/readyz", api.HandleReady).Methods("GET")
+
+	routes := router.PathPrefix("/").Subrouter()
+	routes.HandleFunc("/favorites/{user_id}", api.HandleGetFavorites).Methods("GET")
+	routes.HandleFunc("/favorites/{user_id}", api.HandleAddFavorite).Methods("POST")
+	routes.HandleFunc("/multiple/favorites/{user_id}", api.HandleAddMultipleFavorites).Methods("POST")
+	routes.HandleFunc("/multiple/favorites/{user_id}", api.HandleRemoveMultipleFavorites).Methods("DELETE")
+	routes.HandleFunc("/multiple/favorites/{user_id}", api.HandleEditMultipleDescriptions).Methods("PUT")
+	routes.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleRemoveFavorite).Methods("DELETE")
+	routes.HandleFunc("/favorites/{user_id}/{asset_id}", api.HandleEditDescription).Methods("PUT")
+	// First, so that the requests turned away by the other middlewares are traced, logged and counted too
+	routes.Use(api.trace, api.logRequests, api.instrument)
+	// Before authentication, so that the requests with missing or wrong credentials are limited too
+	if api.rateLimiter != nil {
+		routes.Use(api.rateLimitIP)
+	}
+	if api.authenticator != nil {
+		if api.apiKeys != nil && api.features.AdminAPI {
+			routes.HandleFunc("/admin/api-keys", api.HandleCreateAPIKey).Methods("POST")
+			routes.HandleFunc("/admin/api-keys", api.HandleListAPIKeys).Methods("GET")
+			routes.HandleFunc("/admin/api-keys/{key_id}", api.HandleRevokeAPIKey).Methods("DELETE")
+		}
+		routes.Use(api.authenticate)
+	}
+	// After authentication, so that authenticated clients are limited by who they are
+	if api.rateLimiter != nil {
+		routes.Use(api.rateLimit)
+	}
 	return router
 }
 
@@ -42,16 +109,51 @@ func WriteJSON(w http.ResponseWriter, status int, v any) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
+// Body of the list of favorites, next_cursor is the cursor of the next page when there is one.
+// total and total_pages are left out when counting is turned off and page when a cursor is used.
+type favoritesResponse struct {
+	Items      []models.Favorite `json:"items"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	HasMore    bool              `json:"has_more"`
+	Total      *int              `json:"total,omitempty"`
+	Page       int               `json:"page,omitempty"`
+	PageSize   int               `json:"page_size"`
+	TotalPages *int              `json:"total_pages,omitempty"`
+}
+
+type validationErrorResponse struct {
+	Error  string              `json:"error"`
+	Fields []models.FieldError `json:"fields"`
+}
+
+// Writes a 422 response listing the fields that failed validation
+func writeValidationError(w http.ResponseWriter, r *http.Request, fields []models.FieldError) {
+	logging.FromContext(r.Context()).Info("validation failed", slog.Any("fields", fields))
+	err := WriteJSON(w, http.StatusUnprocessableEntity, validationErrorResponse{Error: "validation failed", Fields: fields})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("error writing the json", slog.Any("error", err))
+	}
+}
+
+// Returns the fields of a validation error, or nil when the error is of another kind
+func validationFields(err error) []models.FieldError {
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Fields
+	}
+	return nil
+}
+
 func (api *API) HandleGetFavorites(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := api.requestContext(r)
 	defer cancel()
 
+	logger := logging.FromContext(ctx)
 	userID := mux.Vars(r)["user_id"]
-	log.Println("GET request received for user : ", userID)
 
-	//Get filtering type
+	//Get filtering types, either type=Chart,Insight or repeated type parameters
 	queryParams := r.URL.Query()
-	filterType := queryParams.Get("type")
+	filterType := strings.Join(queryParams["type"], ",")
 
 	// Get pagination parameters
 	pageStr := queryParams.Get("page")
@@ -64,145 +166,270 @@ func (api *API) HandleGetFavorites(w http.ResponseWriter, r *http.Request) {
 	}
 	pageSize, err := strconv.Atoi(pageSizeStr)
 	if err != nil || pageSize < 1 {
-		pageSize = 10
+		pageSize = api.defaultPageSize
+	}
+	// Larger pages are cut down rather than refused, the next_cursor and the links lead to the rest
+	if pageSize > api.maxPageSize {
+		pageSize = api.maxPageSize
 	}
-	log.Println("userid : " + userID + " type : " + filterType + " page : " + pageStr + " page size : " + pageSizeStr)
+	logger.Debug("listing favorites", slog.String("type", filterType), slog.Int("page", page), slog.Int("page_size", pageSize))
+
+	opts := storage.ListOptions{Search: strings.TrimSpace(queryParams.Get("q")), Page: page, PageSize: pageSize}
 
-	var assets []models.Asset
-	err = utils.RetryWithExponentialBackoff(ctx, func() error {
+	if opts.Search != "" && !api.features.Search {
+		logger.Info("search is turned off")
+		http.Error(w, "search is turned off", http.StatusBadRequest)
+		return
+	}
+
+	opts.Types, err = storage.ParseTypes(queryParams["type"])
+	if err != nil {
+		logger.Info("invalid asset type", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Sort fields are checked against the allow-list of the storage layer
+	opts.Sort, err = storage.ParseSort(queryParams.Get("sort"))
+	if err != nil {
+		logger.Info("invalid sort", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Audience, err = storage.ParseAudienceFilters(queryParams)
+	if err != nil {
+		logger.Info("invalid audience filter", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := opts.Validate(); err != nil {
+		logger.Info("invalid list options", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A cursor takes precedence over the page number
+	if cursorStr := queryParams.Get("cursor"); cursorStr != "" {
+		opts.After, err = storage.DecodeCursor(cursorStr)
+		if err != nil {
+			logger.Info("invalid cursor", slog.String("cursor", cursorStr))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !opts.After.Matches(opts.Order()) {
+			logger.Info("cursor does not match the sort order", slog.String("cursor", cursorStr))
+			http.Error(w, "cursor does not match the sort order", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Counting can be skipped for speed with count=false
+	countTotal := queryParams.Get("count") != "false"
+
+	var favoritesPage storage.FavoritesPage
+	var total int
+	err = api.retry(ctx, func(ctx context.Context) error {
 		var err error
-		assets, err = api.db.GetUserFavorites(ctx, userID, filterType, page, pageSize)
+		favoritesPage, err = api.db.GetUserFavorites(ctx, userID, opts)
 		return err
 	})
+	if err == nil && countTotal {
+		err = api.retry(ctx, func(ctx context.Context) error {
+			var err error
+			total, err = api.db.CountUserFavorites(ctx, userID, opts)
+			return err
+		})
+	}
 	if err != nil {
-		if err == context.DeadlineExceeded {
-			log.Println("Request timed out:", err)
-			http.Error(w, "Request timed out", http.StatusGatewayTimeout)
-		} else if strings.Contains(err.Error(), "invalid asset type") {
-			log.Println("Invalid asset type", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		} else {
-			log.Println("Error on executing the query ", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeStorageError(w, r, err)
 		return
 	}
-	err = WriteJSON(w, http.StatusOK, assets)
+
+	response := favoritesResponse{Items: favoritesPage.Favorites, HasMore: favoritesPage.HasMore, PageSize: pageSize}
+	if response.Items == nil {
+		response.Items = []models.Favorite{}
+	}
+	if favoritesPage.HasMore {
+		response.NextCursor = favoritesPage.Next.Encode()
+	}
+	// Page numbers only make sense with offset pagination
+	if opts.After == nil {
+		response.Page = page
+	}
+	if countTotal {
+		totalPages := (total + pageSize - 1) / pageSize
+		response.Total = &total
+		response.TotalPages = &totalPages
+	}
+
+	w.Header().Set("Link", paginationLinks(r.URL, opts, favoritesPage, response.TotalPages))
+	err = WriteJSON(w, http.StatusOK, response)
 	if err != nil {
-		log.Println("Error writing the json", err)
+		logger.Error("error writing the json", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
 func (api *API) HandleAddFavorite(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel := api.requestContext(r)
 	defer cancel()
 
+	logger := logging.FromContext(ctx)
 	userID := mux.Vars(r)["user_id"]
-	log.Println("POST request received to add a single asset for user : ", userID)
 
 	var asset models.Asset
 	err := json.NewDecoder(r.Body).Decode(&asset)
 	if err != nil {
-		log.Println("Invalid request payload ", err)
+		logger.Info("invalid request payload", slog.Any("error", err))
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
-	log.Println("Asset to be added -> asset id : "+
-		asset.ID, asset.Type, asset.Description, string(asset.Data))
+	logger.Debug("adding favorite", slog.Any("asset", asset))
+
+	if err := asset.Validate(); err != nil {
+		writeValidationError(w, r, validationFields(err))
+		return
+	}
 
-	err = utils.RetryWithExponentialBackoff(ctx, func() error {
+	err = api.retry(ctx, func(ctx context.Context) error {
 		return api.db.AddFavorite(ctx, userID, asset)
 	})
 
 	if err != nil {
-		if err == context.DeadlineExceeded {
-			log.Println("Request timed out: ", err)
-			http.Error(w, "Request timed out", http.StatusGatewayTimeout)
-		} else {
-			log.Println("Error on executing the query ", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeStorageError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
 }
 
 func (api *API) HandleAddMultipleFavorites(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel := api.requestContext(r)
 	defer cancel()
 
+	logger := logging.FromContext(ctx)
 	userID := mux.Vars(r)["user_id"]
-	log.Println("POST request received to add multiple assets for user : ", userID)
 
-	var assets []models.Asset
-	err := json.NewDecoder(r.Body).Decode(&assets)
-	if err != nil {
-		log.Println("Invalid request payload ", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	assets, ok := decodeBatch[models.Asset](api, w, r)
+	if !ok {
 		return
 	}
 
-	var wg sync.WaitGroup
-	errCh := make(chan *models.AssetError, len(assets))
+	atomicMode := false
+	if value := r.URL.Query().Get("atomic"); value != "" {
+		var err error
+		atomicMode, err = strconv.ParseBool(value)
+		if err != nil {
+			logger.Info("invalid atomic parameter", slog.String("atomic", value))
+			http.Error(w, "atomic must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	if atomicMode {
+		api.addFavoritesAtomically(ctx, w, r, userID, assets)
+		return
+	}
 
-	// Use a goroutine to add each asset concurrently
-	for _, asset := range assets {
-		log.Println("Asset to be added -> asset id : "+
-			asset.ID, asset.Type, asset.Description, string(asset.Data))
-		wg.Add(1)
-		go func(asset models.Asset) {
-			defer wg.Done()
-			localErr := utils.RetryWithExponentialBackoff(ctx, func() error {
-				return api.db.AddFavorite(ctx, userID, asset)
-			})
-			if localErr != nil {
+	// The invalid assets are reported and the others are added
+	var assetErrs []models.AssetError
+	var valid []int
+	for i, asset := range assets {
+		if err := asset.Validate(); err != nil {
+			logger.Info("validation failed", slog.Int("index", i), slog.Any("fields", validationFields(err)))
+			assetErrs = append(assetErrs, models.AssetError{Index: i, Asset: asset, Err: err})
+			continue
+		}
+		valid = append(valid, i)
+	}
+	valid, repeated := firstOccurrences(assets, valid)
+	assetErrs = append(assetErrs, repeated...)
+
+	// The assets are added a few at a time, the ones still queued when the request times out are not added
+	errs := api.bulkExecutor.Run(ctx, len(valid), func(ctx context.Context, i int) error {
+		asset := assets[valid[i]]
+		logger.Debug("adding favorite", slog.Any("asset", asset))
+		return api.retry(ctx, func(ctx context.Context) error {
+			return api.db.AddFavorite(ctx, userID, asset)
+		})
+	})
 
-				errCh <- &models.AssetError{Asset: asset, Err: localErr}
-			}
-		}(asset)
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		asset := assets[valid[i]]
+		switch status := errorStatus(err); {
+		case status == http.StatusGatewayTimeout:
+			logger.Warn("request timed out", slog.String("asset_id", asset.ID), slog.Any("error", err))
+		case status < http.StatusInternalServerError:
+			logger.Info("favorite not added", slog.String("asset_id", asset.ID), slog.Any("error", err))
+		default:
+			logger.Error("error on executing the query", slog.String("asset_id", asset.ID), slog.Any("error", err))
+		}
+		assetErrs = append(assetErrs, models.AssetError{Index: valid[i], Asset: asset, Err: err})
 	}
 
-	// Wait for all goroutines to finish and close the error channel
-	wg.Wait()
-	close(errCh)
+	writeBulkResponse(w, r, http.StatusCreated, newBulkResponse(addOutcomes, assetIDsOf(assets), assetErrs))
+}
+
+// Adds the whole batch in a single transaction, nothing is added when one of the assets is invalid or fails
+func (api *API) addFavoritesAtomically(ctx context.Context, w http.ResponseWriter, r *http.Request, userID string, assets []models.Asset) {
+	logger := logging.FromContext(ctx)
 
-	// Check for errors in goroutines
-	for assetErr := range errCh {
-		if assetErr.Err == context.DeadlineExceeded {
-			log.Println("Request timed out for asset ID ", assetErr.Asset.ID+" and error message: ", assetErr.Err)
-			http.Error(w, "Request timed out", http.StatusGatewayTimeout)
-		} else {
-			log.Println("Error on executing the query for asset ID ", assetErr.Asset.ID+" and error message: ", assetErr.Err)
-			http.Error(w, assetErr.Err.Error(), http.StatusInternalServerError)
+	var invalidFields []models.FieldError
+	for i, asset := range assets {
+		for _, fieldErr := range validationFields(asset.Validate()) {
+			invalidFields = append(invalidFields, models.FieldError{Field: fmt.Sprintf("[%d].%s", i, fieldErr.Field), Message: fieldErr.Message})
 		}
 	}
+	if len(invalidFields) > 0 {
+		writeValidationError(w, r, invalidFields)
+		return
+	}
 
-	w.WriteHeader(http.StatusCreated)
+	indexes := make([]int, len(assets))
+	for i := range assets {
+		indexes[i] = i
+	}
+	indexes, assetErrs := firstOccurrences(assets, indexes)
+	unique := make([]models.Asset, len(indexes))
+	for j, i := range indexes {
+		unique[j] = assets[i]
+	}
+
+	logger.Debug("adding favorites atomically", slog.Int("assets", len(unique)))
+	var added []string
+	err := api.retry(ctx, func(ctx context.Context) error {
+		var err error
+		added, err = api.db.AddFavorites(ctx, userID, unique)
+		return err
+	})
+
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	// The assets that were not added already were favorites of the user
+	assetErrs = append(assetErrs, batchErrors(ctx, indexes, assetIDsOf(unique), added, nil, storage.ErrAlreadyExists)...)
+	writeBulkResponse(w, r, http.StatusCreated, newBulkResponse(addOutcomes, assetIDsOf(assets), assetErrs))
 }
 
 func (api *API) HandleRemoveFavorite(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := api.requestContext(r)
 	defer cancel()
 
+	logger := logging.FromContext(ctx)
 	userID := mux.Vars(r)["user_id"]
 	assetID := mux.Vars(r)["asset_id"]
 
-	log.Println("DELETE request received for user : ", userID+" with asset id : "+assetID)
+	logger.Debug("removing favorite", slog.String("asset_id", assetID))
 
-	err := utils.RetryWithExponentialBackoff(ctx, func() error {
+	err := api.retry(ctx, func(ctx context.Context) error {
 		return api.db.RemoveFavorite(ctx, userID, assetID)
 	})
 
 	if err != nil {
-		if err == context.DeadlineExceeded {
-			log.Println("Request timed out: ", err)
-			http.Error(w, "Request timed out ", http.StatusGatewayTimeout)
-		} else {
-			log.Println("Error on executing the query ", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeStorageError(w, r, err)
 		return
 	}
 
@@ -210,39 +437,32 @@ func (api *API) HandleRemoveFavorite(w http.ResponseWriter, r *http.Request) {
 }
 
 func (api *API) HandleEditDescription(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel := api.requestContext(r)
 	defer cancel()
 
+	logger := logging.FromContext(ctx)
 	userID := mux.Vars(r)["user_id"]
 	assetID := mux.Vars(r)["asset_id"]
 
-	log.Println("PUT request received for user : ", userID)
-
 	var updatedDescription struct {
 		Description string `json:"description"`
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&updatedDescription)
 	if err != nil {
-		log.Println("Invalid request payload", err)
+		logger.Info("invalid request payload", slog.Any("error", err))
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	log.Println("Asset to be edited--> asset id : " + assetID + " and updateDescreption : " + updatedDescription.Description)
+	logger.Debug("editing the description", slog.String("asset_id", assetID), slog.String("description", updatedDescription.Description))
 
-	err = utils.RetryWithExponentialBackoff(ctx, func() error {
+	err = api.retry(ctx, func(ctx context.Context) error {
 		return api.db.UpdateDescription(ctx, userID, assetID, updatedDescription.Description)
 	})
 
 	if err != nil {
-		if err == context.DeadlineExceeded {
-			log.Println("Request timed out: ", err)
-			http.Error(w, "Request timed out", http.StatusGatewayTimeout)
-		} else {
-			log.Println("Error on executing the query ", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeStorageError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/logging"
+)
+
+// How long each readiness check may take before the dependency is considered down
+const readinessTimeout = 2 * time.Second
+
+// ReadinessCheck tells whether a dependency can serve requests, ctx carries the timeout of the check
+type ReadinessCheck func(ctx context.Context) error
+
+// Adds a dependency to the readiness probe, the storage is always checked
+func WithReadinessCheck(name string, check ReadinessCheck) Option {
+	return func(api *API) {
+		api.readinessChecks[name] = check
+	}
+}
+
+// Fails the readiness probe from now on, so that the instance is taken out of the load balancer
+// while it drains the requests it is serving
+func (api *API) StartShutdown() {
+	api.shuttingDown.Store(true)
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+type checkResult struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Liveness probe, the process answers so it is alive
+func (api *API) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	if err := WriteJSON(w, http.StatusOK, healthResponse{Status: "ok"}); err != nil {
+		logging.FromContext(r.Context()).Error("error writing the json", slog.Any("error", err))
+	}
+}
+
+// Readiness probe, the instance is ready when every dependency is and it is not shutting down
+func (api *API) HandleReady(w http.ResponseWriter, r *http.Request) {
+	if api.shuttingDown.Load() {
+		if err := WriteJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "shutting_down"}); err != nil {
+			logging.FromContext(r.Context()).Error("error writing the json", slog.Any("error", err))
+		}
+		return
+	}
+
+	response := healthResponse{Status: "ok", Checks: api.runReadinessChecks(r.Context())}
+	status := http.StatusOK
+	for name, result := range response.Checks {
+		if result.Status != "ok" {
+			logging.FromContext(r.Context()).Warn("readiness check failed", slog.String("check", name), slog.String("error", result.Error))
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	if err := WriteJSON(w, status, response); err != nil {
+		logging.FromContext(r.Context()).Error("error writing the json", slog.Any("error", err))
+	}
+}
+
+// Runs the checks concurrently, so that the probe takes as long as the slowest one
+func (api *API) runReadinessChecks(ctx context.Context) map[string]checkResult {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]checkResult, len(api.readinessChecks))
+	for name, check := range api.readinessChecks {
+		wg.Add(1)
+		go func(name string, check ReadinessCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+			result := checkResult{Status: "ok", LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Status = "failing"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/metrics"
+)
+
+// Middleware counting the requests and measuring their latency per route and status
+func (api *API) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		metrics.ObserveRequest(r.Method, routeTemplate(r), recorder.status, time.Since(start))
+	})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/utils"
+)
+
+// Timeouts are how long the requests may take, by route named "<METHOD> <path template>"
+type Timeouts struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// Timeouts of the API unless WithTimeouts is used, the writes may take longer than the reads
+var DefaultTimeouts = Timeouts{
+	Default: 5 * time.Second,
+	Routes: map[string]time.Duration{
+		"POST /favorites/{user_id}":           10 * time.Second,
+		"POST /multiple/favorites/{user_id}":  10 * time.Second,
+		"PUT /favorites/{user_id}/{asset_id}": 10 * time.Second,
+	},
+}
+
+// Features are the parts of the API that can be turned off
+type Features struct {
+	// Full-text search with the q parameter
+	Search bool
+	// The endpoints managing the API keys, when authentication is on
+	AdminAPI bool
+	// The /metrics endpoint
+	Metrics bool
+}
+
+var DefaultFeatures = Features{Search: true, AdminAPI: true, Metrics: true}
+
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(api *API) {
+		api.timeouts = timeouts
+	}
+}
+
+// Retries the storage operations with the policy instead of utils.DefaultRetryPolicy
+func WithRetryPolicy(policy utils.RetryPolicy) Option {
+	return func(api *API) {
+		api.retryPolicy = policy
+	}
+}
+
+// Sets the page size of the lists when the request has none, and the largest one a request may ask for
+func WithPagination(defaultPageSize, maxPageSize int) Option {
+	return func(api *API) {
+		api.defaultPageSize = defaultPageSize
+		api.maxPageSize = maxPageSize
+	}
+}
+
+// Sets the most assets a bulk request may carry, larger ones are refused with 413,
+// and how many of them are stored at a time
+func WithBulkLimits(maxBatchSize, concurrency int) Option {
+	return func(api *API) {
+		api.maxBatchSize = maxBatchSize
+		api.bulkExecutor = utils.Executor{Concurrency: concurrency}
+	}
+}
+
+func WithFeatures(features Features) Option {
+	return func(api *API) {
+		api.features = features
+	}
+}
+
+// Returns the context of a request, done once the timeout of its route is over
+func (api *API) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout, ok := api.timeouts.Routes[routeName(r)]
+	if !ok {
+		timeout = api.timeouts.Default
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/arhsxro/platform-go-challenge/storage"
+)
+
+// Builds the RFC 8288 Link header of a page of favorites.
+// With a cursor there is no previous page and the next one is reached through the cursor,
+// last is only known when the favorites were counted. A requested page size is replaced
+// with the one the page was read with, which is clamped to the max page size.
+func paginationLinks(requestURL *url.URL, opts storage.ListOptions, page storage.FavoritesPage, totalPages *int) string {
+	var links []string
+	addLink := func(rel string, setParams func(params url.Values)) {
+		params := requestURL.Query()
+		if params.Has("pageSize") {
+			params.Set("pageSize", strconv.Itoa(opts.PageSize))
+		}
+		setParams(params)
+		target := url.URL{Path: requestURL.Path, RawQuery: params.Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, target.String(), rel))
+	}
+	atPage := func(number int) func(params url.Values) {
+		return func(params url.Values) {
+			params.Del("cursor")
+			params.Set("page", strconv.Itoa(number))
+		}
+	}
+
+	addLink("first", atPage(1))
+	if opts.After == nil {
+		if opts.Page > 1 {
+			addLink("prev", atPage(opts.Page-1))
+		}
+		if page.HasMore {
+			addLink("next", atPage(opts.Page+1))
+		}
+	} else if page.HasMore {
+		addLink("next", func(params url.Values) {
+			params.Del("page")
+			params.Set("cursor", page.Next.Encode())
+		})
+	}
+	if totalPages != nil {
+		addLink("last", atPage(max(*totalPages, 1)))
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/auth"
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+// Limits how often each client calls each route. Authenticated clients are told apart by
+// their principal, the others by their IP, taken from X-Forwarded-For when trustProxy is set.
+// The proxy must append the address it received the request from to the header.
+func WithRateLimiter(limiter *ratelimit.Limiter, trustProxy bool) Option {
+	return func(api *API) {
+		api.rateLimiter = limiter
+		api.trustProxy = trustProxy
+	}
+}
+
+// Middleware rejecting the requests of clients over the limit of the route with 429
+func (api *API) rateLimit(next http.Handler) http.Handler {
+	return api.limit(next, func(r *http.Request) (ratelimit.Result, ratelimit.Limit, bool, error) {
+		return api.rateLimiter.Take(r.Context(), routeName(r), api.clientKey(r))
+	})
+}
+
+// Middleware rejecting the requests of IPs over their limit across the routes with 429. It runs before
+// authentication, so that a client guessing credentials is limited and does not cost a lookup on every try.
+func (api *API) rateLimitIP(next http.Handler) http.Handler {
+	return api.limit(next, func(r *http.Request) (ratelimit.Result, ratelimit.Limit, bool, error) {
+		return api.rateLimiter.TakeIP(r.Context(), api.clientIP(r))
+	})
+}
+
+// Wraps next with the bucket take returns, a request the bucket does not allow gets 429
+func (api *API) limit(next http.Handler, take func(r *http.Request) (ratelimit.Result, ratelimit.Limit, bool, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, limit, limited, err := take(r)
+		if err != nil {
+			// A failing shared backend should not take the API down with it
+			logging.FromContext(r.Context()).Error("error on checking the rate limit", slog.Any("error", err))
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		w.Header().Set("RateLimit-Policy", strconv.Itoa(limit.Burst)+";w="+strconv.Itoa(ceilSeconds(limit.Window())))
+		if !result.Allowed {
+			logging.FromContext(r.Context()).Info("rate limit reached", slog.String("client", api.clientKey(r)))
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Returns the name of the route in the rate limit rules, "<METHOD> <path template>"
+func routeName(r *http.Request) string {
+	return r.Method + " " + routeTemplate(r)
+}
+
+// Returns the path template of the route that matched the request, its path when none did
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// Returns the key of the bucket of the client
+func (api *API) clientKey(r *http.Request) string {
+	if principal, ok := auth.FromContext(r.Context()); ok {
+		if principal.Service {
+			return "key:" + principal.Subject
+		}
+		return "user:" + principal.Subject
+	}
+	return "ip:" + api.clientIP(r)
+}
+
+// Returns the IP of the client
+func (api *API) clientIP(r *http.Request) string {
+	if api.trustProxy {
+		// The entries before the last one come from the client, who could change them on every request
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			last := forwarded[len(forwarded)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if client := strings.TrimSpace(last); client != "" {
+				return client
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/auth"
+	"github.com/arhsxro/platform-go-challenge/config"
+)
+
+const apiKeyUsage = `usage: main apikey <command>
+
+commands:
+  create -name <name> -scopes <scopes> [-expires-in <duration>]
+             create a key and print it, scopes are a comma separated list of favorites:read, favorites:write and admin
+  list       list the keys
+  revoke <id>
+             revoke a key`
+
+// Runs the apikey subcommand, it is how the first admin key is created
+func runAPIKey(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	dbInstance, err := connectPostgres(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbInstance.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		name := flags.String("name", "", "name of the key")
+		scopes := flags.String("scopes", "", "comma separated scopes of the key")
+		expiresIn := flags.Duration("expires-in", 0, "lifetime of the key, the key does not expire when unset")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" || *scopes == "" {
+			return errors.New(apiKeyUsage)
+		}
+
+		var expiresAt *time.Time
+		if *expiresIn > 0 {
+			at := time.Now().UTC().Add(*expiresIn)
+			expiresAt = &at
+		}
+		key, token, err := auth.NewAPIKey(*name, strings.Split(*scopes, ","), expiresAt)
+		if err != nil {
+			return err
+		}
+		if err := dbInstance.CreateAPIKey(ctx, key); err != nil {
+			return err
+		}
+		fmt.Printf("Created api key %s, it is only shown once:\n%s\n", key.ID, token)
+		return nil
+	case "list":
+		keys, err := dbInstance.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSCOPES\tEXPIRES AT\tLAST USED AT\tREVOKED AT")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, strings.Join(key.Scopes, ","),
+				formatOptionalTime(key.ExpiresAt), formatOptionalTime(key.LastUsedAt), formatOptionalTime(key.RevokedAt))
+		}
+		return w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(apiKeyUsage)
+		}
+		return dbInstance.RevokeAPIKey(ctx, args[1])
+	default:
+		return errors.New(apiKeyUsage)
+	}
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05 MST")
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/models"
+	"github.com/arhsxro/platform-go-challenge/storage"
+)
+
+// Scopes of the API keys, users authenticated with a JWT may read and write their own favorites
+const (
+	ScopeRead  = "favorites:read"
+	ScopeWrite = "favorites:write"
+)
+
+// The scopes an API key can be given
+var ValidScopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// API keys look like fav_<id>_<secret>, the id finds the key and the secret proves it
+const apiKeyPrefix = "fav_"
+
+// Creates a key with a random id and secret, the returned token is what the client sends
+func NewAPIKey(name string, scopes []string, expiresAt *time.Time) (models.APIKey, string, error) {
+	for _, scope := range scopes {
+		if !slices.Contains(ValidScopes, scope) {
+			return models.APIKey{}, "", fmt.Errorf("invalid scope %q, expected one of %s", scope, strings.Join(ValidScopes, ", "))
+		}
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return models.APIKey{}, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	key := models.APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	key.SecretHash = hashAPIKeySecret(encodedSecret)
+	return key, apiKeyPrefix + key.ID + "_" + encodedSecret, nil
+}
+
+// The secrets are long and random, so a fast hash is enough
+func hashAPIKeySecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// APIKeyStore is the part of storage.APIKeyStore authentication needs
+type APIKeyStore interface {
+	GetAPIKey(ctx context.Context, id string) (models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// APIKeyAuthenticator authenticates services with an "Authorization: ApiKey <key>" header.
+// Services act on any user within the scopes of their key.
+type APIKeyAuthenticator struct {
+	store APIKeyStore
+}
+
+func NewAPIKeyAuthenticator(store APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{store: store}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey ")
+	if !ok {
+		return nil, ErrMissingCredentials
+	}
+	id, secret, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(token), apiKeyPrefix), "_")
+	if !ok || id == "" || secret == "" {
+		return nil, fmt.Errorf("%w: malformed api key", ErrInvalidCredentials)
+	}
+
+	key, err := a.store.GetAPIKey(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown api key %s", ErrInvalidCredentials, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, fmt.Errorf("%w: wrong secret for api key %s", ErrInvalidCredentials, id)
+	}
+	now := time.Now().UTC()
+	if !key.Active(now) {
+		return nil, fmt.Errorf("%w: api key %s is revoked or expired", ErrInvalidCredentials, id)
+	}
+
+	// Failing to record the use does not fail the request
+	if err := a.store.TouchAPIKey(r.Context(), id, now); err != nil {
+		logging.FromContext(r.Context()).Warn("failed to record the use of the api key", slog.String("key_id", id), slog.Any("error", err))
+	}
+
+	return &Principal{Subject: key.ID, Scopes: key.Scopes, Service: true}, nil
+}
+
+// Chain tries each authenticator in turn, the first one that finds credentials decides
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrMissingCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrMissingCredentials
+}
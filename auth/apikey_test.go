@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requestWithAPIKey(token string) *http.Request {
+	r, _ := http.NewRequest("GET", "/favorites/user1", nil)
+	r.Header.Set("Authorization", "ApiKey "+token)
+	return r
+}
+
+func TestNewAPIKey(t *testing.T) {
+	key, token, err := NewAPIKey("exporter", []string{ScopeRead}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "fav_"+key.ID+"_"))
+	assert.NotContains(t, key.SecretHash, strings.TrimPrefix(token, "fav_"+key.ID+"_"), "the secret is stored in clear")
+
+	_, other, err := NewAPIKey("exporter", []string{ScopeRead}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	_, _, err = NewAPIKey("exporter", []string{"favorites:delete"}, nil)
+	assert.Error(t, err)
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	authenticator := NewAPIKeyAuthenticator(store)
+
+	key, token, err := NewAPIKey("exporter", []string{ScopeRead}, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAPIKey(ctx, key))
+
+	principal, err := authenticator.Authenticate(requestWithAPIKey(token))
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Subject: key.ID, Scopes: []string{ScopeRead}, Service: true}, principal)
+	assert.True(t, principal.CanActFor("any user"))
+	assert.False(t, principal.Allows(ScopeWrite))
+
+	stored, err := store.GetAPIKey(ctx, key.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored.LastUsedAt, "the use of the key was not recorded")
+
+	expiredAt := time.Now().Add(-time.Minute)
+	expired, expiredToken, err := NewAPIKey("old job", []string{ScopeRead}, &expiredAt)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAPIKey(ctx, expired))
+
+	revoked, revokedToken, err := NewAPIKey("retired job", []string{ScopeAdmin}, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAPIKey(ctx, revoked))
+	require.NoError(t, store.RevokeAPIKey(ctx, revoked.ID))
+
+	tests := map[string]string{
+		"expired":      expiredToken,
+		"revoked":      revokedToken,
+		"wrong secret": "fav_" + key.ID + "_not-the-secret",
+		"unknown key":  "fav_0123456789abcdef_secret",
+		"malformed":    "fav_nosecret",
+	}
+	for name, token := range tests {
+		_, err := authenticator.Authenticate(requestWithAPIKey(token))
+		assert.ErrorIs(t, err, ErrInvalidCredentials, name)
+	}
+
+	_, err = authenticator.Authenticate(requestWithToken("a bearer token"))
+	assert.ErrorIs(t, err, ErrMissingCredentials)
+}
+
+func TestChain(t *testing.T) {
+	store := storage.NewMemoryStore()
+	key, token, err := NewAPIKey("exporter", []string{ScopeRead}, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAPIKey(context.Background(), key))
+
+	jwtAuthenticator, err := NewJWTAuthenticator(JWTConfig{HMACSecret: testSecret})
+	require.NoError(t, err)
+	chain := Chain{jwtAuthenticator, NewAPIKeyAuthenticator(store)}
+
+	principal, err := chain.Authenticate(requestWithToken(signHS256(t, validClaims("user1"), testSecret)))
+	require.NoError(t, err)
+	assert.Equal(t, "user1", principal.Subject)
+
+	principal, err = chain.Authenticate(requestWithAPIKey(token))
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, principal.Subject)
+
+	// The first authenticator that finds credentials decides
+	_, err = chain.Authenticate(requestWithToken("not.a.token"))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	r, _ := http.NewRequest("GET", "/favorites/user1", nil)
+	_, err = chain.Authenticate(r)
+	assert.ErrorIs(t, err, ErrMissingCredentials)
+}
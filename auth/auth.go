@@ -0,0 +1,62 @@
+// Package auth tells who calls the API and what they are allowed to do
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+)
+
+var (
+	// The request carries no credentials the authenticator understands
+	ErrMissingCredentials = errors.New("missing credentials")
+	// The request carries credentials that are malformed, expired or not signed by a trusted key
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Scope that allows acting on the favorites of any user
+const ScopeAdmin = "admin"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// The user the caller is, the user_id of the routes, or the id of the API key of a service
+	Subject string
+	Scopes  []string
+	// Services are not users, they act on any user within their scopes
+	Service bool
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Tells whether the principal has the scope, admins have every scope
+func (p *Principal) Allows(scope string) bool {
+	return p.HasScope(scope) || p.HasScope(ScopeAdmin)
+}
+
+// Tells whether the principal may act on the favorites of the user
+func (p *Principal) CanActFor(userID string) bool {
+	return p.Service || p.Subject == userID || p.HasScope(ScopeAdmin)
+}
+
+// Authenticator finds out who made a request
+type Authenticator interface {
+	// Returns ErrMissingCredentials when the request has no credentials of its kind
+	// and an error wrapping ErrInvalidCredentials when they are not valid
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type principalKey struct{}
+
+// Returns a copy of ctx that carries the principal
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Returns the principal of the request, if it was authenticated
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
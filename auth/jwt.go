@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Clock skew tolerated on the exp, nbf and iat claims
+const jwtLeeway = 30 * time.Second
+
+// JWTConfig holds the keys bearer tokens are checked with, at least one of them must be set
+type JWTConfig struct {
+	// Secret of the HS256 tokens
+	HMACSecret []byte
+	// PEM file of the public key of the RS256 tokens
+	RSAPublicKeyFile string
+	// JWKS file of the public keys of the RS256 tokens, picked by the kid header of the token
+	JWKSFile string
+
+	// Expected iss and aud claims, not checked when empty
+	Issuer   string
+	Audience string
+}
+
+// JWTAuthenticator authenticates requests with an "Authorization: Bearer <token>" header.
+// The sub claim is the user and the space separated scope claim holds the scopes,
+// users may always read and write their own favorites.
+type JWTAuthenticator struct {
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	jwks       map[string]*rsa.PublicKey
+	parser     *jwt.Parser
+}
+
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Scope string `json:"scope"`
+}
+
+func NewJWTAuthenticator(cfg JWTConfig) (*JWTAuthenticator, error) {
+	authenticator := &JWTAuthenticator{hmacSecret: cfg.HMACSecret}
+
+	if cfg.RSAPublicKeyFile != "" {
+		pem, err := os.ReadFile(cfg.RSAPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the RSA public key: %v", err)
+		}
+		authenticator.rsaKey, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA public key %s: %v", cfg.RSAPublicKeyFile, err)
+		}
+	}
+	if cfg.JWKSFile != "" {
+		var err error
+		authenticator.jwks, err = loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the algorithms with a configured key are accepted, so a token can't pick another one
+	var methods []string
+	if len(authenticator.hmacSecret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if authenticator.rsaKey != nil || len(authenticator.jwks) > 0 {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no JWT key configured")
+	}
+
+	options := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired(), jwt.WithLeeway(jwtLeeway)}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	authenticator.parser = jwt.NewParser(options...)
+
+	return authenticator, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	var claims jwtClaims
+	if _, err := a.parser.ParseWithClaims(strings.TrimSpace(token), &claims, a.key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	for _, scope := range []string{ScopeRead, ScopeWrite} {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return &Principal{Subject: claims.Subject, Scopes: scopes}, nil
+}
+
+// Returns the key that verifies the signature of the token
+func (a *JWTAuthenticator) key(token *jwt.Token) (any, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return a.hmacSecret, nil
+	case jwt.SigningMethodRS256.Alg():
+		if kid, ok := token.Header["kid"].(string); ok && a.jwks != nil {
+			if key, ok := a.jwks[kid]; ok {
+				return key, nil
+			}
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if a.rsaKey != nil {
+			return a.rsaKey, nil
+		}
+		return nil, errors.New("token has no key id")
+	default:
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+}
+
+// Reads the RSA keys of a JWKS file by key id, keys of other types are skipped
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the JWKS file: %v", err)
+	}
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid JWKS file %s: %v", path, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %q: %v", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key %q: %v", key.Kid, err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no RSA signing key in %s", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("test-secret")
+
+func signHS256(t *testing.T, claims jwt.MapClaims, secret []byte) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	require.NoError(t, err)
+	return token
+}
+
+func signRS256(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims(subject string) jwt.MapClaims {
+	return jwt.MapClaims{"sub": subject, "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func requestWithToken(token string) *http.Request {
+	r, _ := http.NewRequest("GET", "/favorites/user1", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func writeFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	return path
+}
+
+func TestJWTAuthenticator_HS256(t *testing.T) {
+	authenticator, err := NewJWTAuthenticator(JWTConfig{HMACSecret: testSecret, Issuer: "issuer", Audience: "favorites"})
+	require.NoError(t, err)
+
+	claims := validClaims("user1")
+	claims["iss"] = "issuer"
+	claims["aud"] = "favorites"
+	claims["scope"] = "read admin"
+	principal, err := authenticator.Authenticate(requestWithToken(signHS256(t, claims, testSecret)))
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Subject: "user1", Scopes: []string{"read", "admin", ScopeRead, ScopeWrite}}, principal)
+	assert.True(t, principal.CanActFor("user2"))
+}
+
+func TestJWTAuthenticator_InvalidTokens(t *testing.T) {
+	authenticator, err := NewJWTAuthenticator(JWTConfig{HMACSecret: testSecret, Issuer: "issuer"})
+	require.NoError(t, err)
+
+	expired := validClaims("user1")
+	expired["iss"] = "issuer"
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	otherIssuer := validClaims("user1")
+	otherIssuer["iss"] = "someone else"
+
+	withoutExpiry := jwt.MapClaims{"sub": "user1", "iss": "issuer"}
+	withoutSubject := jwt.MapClaims{"iss": "issuer", "exp": time.Now().Add(time.Hour).Unix()}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rs256 := validClaims("user1")
+	rs256["iss"] = "issuer"
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, rs256).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"expired":         signHS256(t, expired, testSecret),
+		"other issuer":    signHS256(t, otherIssuer, testSecret),
+		"without expiry":  signHS256(t, withoutExpiry, testSecret),
+		"without subject": signHS256(t, withoutSubject, testSecret),
+		"other secret":    signHS256(t, rs256, []byte("another secret")),
+		"unexpected alg":  signRS256(t, rs256, rsaKey, ""),
+		"unsigned":        unsigned,
+		"malformed":       "not.a.token",
+	}
+	for name, token := range tests {
+		_, err := authenticator.Authenticate(requestWithToken(token))
+		assert.ErrorIs(t, err, ErrInvalidCredentials, name)
+	}
+
+	_, err = authenticator.Authenticate(requestWithToken(""))
+	assert.ErrorIs(t, err, ErrMissingCredentials)
+}
+
+func TestJWTAuthenticator_RS256PublicKeyFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	path := writeFile(t, "key.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	authenticator, err := NewJWTAuthenticator(JWTConfig{RSAPublicKeyFile: path})
+	require.NoError(t, err)
+
+	principal, err := authenticator.Authenticate(requestWithToken(signRS256(t, validClaims("user1"), key, "")))
+	require.NoError(t, err)
+	assert.Equal(t, "user1", principal.Subject)
+
+	// HS256 tokens signed with the public key must not pass when only RSA keys are configured
+	_, err = authenticator.Authenticate(requestWithToken(signHS256(t, validClaims("user1"), der)))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestJWTAuthenticator_JWKS(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwk := func(kid string, key *rsa.PublicKey) map[string]string {
+		return map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	}
+	jwks, err := json.Marshal(map[string]any{"keys": []any{jwk("key1", &key1.PublicKey), jwk("key2", &key2.PublicKey), map[string]string{"kty": "EC", "kid": "ec"}}})
+	require.NoError(t, err)
+
+	authenticator, err := NewJWTAuthenticator(JWTConfig{JWKSFile: writeFile(t, "jwks.json", jwks)})
+	require.NoError(t, err)
+
+	for kid, key := range map[string]*rsa.PrivateKey{"key1": key1, "key2": key2} {
+		principal, err := authenticator.Authenticate(requestWithToken(signRS256(t, validClaims("user1"), key, kid)))
+		require.NoError(t, err, kid)
+		assert.Equal(t, "user1", principal.Subject)
+	}
+
+	// A token signed with one key but naming another
+	_, err = authenticator.Authenticate(requestWithToken(signRS256(t, validClaims("user1"), key1, "key2")))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = authenticator.Authenticate(requestWithToken(signRS256(t, validClaims("user1"), key1, "unknown")))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestNewJWTAuthenticator_WithoutKeys(t *testing.T) {
+	_, err := NewJWTAuthenticator(JWTConfig{Issuer: "issuer"})
+	assert.Error(t, err)
+}
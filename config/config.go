@@ -1,23 +1,123 @@
+// Package config loads the settings of the app from defaults, a YAML or TOML file, the env and the flags
 package config
 
 import (
-	"os"
+	"time"
 )
 
+// Storage backends the app can run with
+const (
+	PostgresBackend = "postgres"
+	MemoryBackend   = "memory"
+)
+
+// Config holds every setting of the app. Each field is read from the key of the file, the env var
+// and the flag named in its tags, the default tag applies when none of them is set.
 type Config struct {
-	DBUsername string
-	DBPassword string
-	DBName     string
-	DBHost     string
-	DBPort     string
+	// Address the HTTP server listens on
+	HTTPAddr string `key:"server.addr" env:"HTTP_ADDR" default:":8080"`
+	// Serve HTTPS with this certificate and key, both are needed
+	TLSCertFile string `key:"server.tls_cert_file" env:"HTTP_TLS_CERT_FILE"`
+	TLSKeyFile  string `key:"server.tls_key_file" env:"HTTP_TLS_KEY_FILE"`
+	// Timeouts of the HTTP server, see http.Server
+	ReadTimeout       time.Duration `key:"server.read_timeout" env:"HTTP_READ_TIMEOUT" default:"15s"`
+	ReadHeaderTimeout time.Duration `key:"server.read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" default:"5s"`
+	WriteTimeout      time.Duration `key:"server.write_timeout" env:"HTTP_WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout       time.Duration `key:"server.idle_timeout" env:"HTTP_IDLE_TIMEOUT" default:"60s"`
+	// How long the server keeps running, failing readiness, before it stops accepting connections
+	// so that the load balancer has time to notice
+	ShutdownDelay time.Duration `key:"server.shutdown_delay" env:"HTTP_SHUTDOWN_DELAY" default:"0s"`
+	// How long the requests in flight have to finish once the server stops
+	ShutdownGracePeriod time.Duration `key:"server.shutdown_grace_period" env:"HTTP_SHUTDOWN_GRACE_PERIOD" default:"20s"`
+
+	// Time a request may take when its route has no timeout of its own
+	RequestTimeout time.Duration `key:"timeouts.default" env:"REQUEST_TIMEOUT" default:"5s"`
+	// Timeouts of single routes as parsed by ParseRouteTimeouts
+	RouteTimeouts string `key:"timeouts.routes" env:"REQUEST_TIMEOUT_ROUTES" default:"POST /favorites/{user_id}=10s;POST /multiple/favorites/{user_id}=10s;PUT /favorites/{user_id}/{asset_id}=10s"`
+
+	// Attempts made by the retried storage operations, and the backoff that grows with each of them
+	RetryMaxAttempts int           `key:"retry.max_attempts" env:"RETRY_MAX_ATTEMPTS" default:"3"`
+	RetryBackoff     time.Duration `key:"retry.backoff" env:"RETRY_BACKOFF" default:"1s"`
+
+	// Page size of the lists when the request has none, and the largest one a request may ask for
+	DefaultPageSize int `key:"pagination.default_page_size" env:"PAGINATION_DEFAULT_PAGE_SIZE" default:"10"`
+	MaxPageSize     int `key:"pagination.max_page_size" env:"PAGINATION_MAX_PAGE_SIZE" default:"100"`
+
+	// Most assets a bulk request may carry, and how many of them are stored at a time.
+	// The concurrency should stay below database.max_open_conns so that other requests get connections.
+	BulkMaxBatchSize int `key:"bulk.max_batch_size" env:"BULK_MAX_BATCH_SIZE" default:"1000"`
+	BulkConcurrency  int `key:"bulk.concurrency" env:"BULK_CONCURRENCY" default:"8"`
+
+	// Where the favorites are stored, postgres or memory
+	StorageBackend string `key:"storage.backend" env:"STORAGE_BACKEND" default:"postgres"`
+
+	DBUsername string `key:"database.username" env:"DB_USERNAME"`
+	DBPassword string `key:"database.password" env:"DB_PASSWORD" secret:"true"`
+	DBName     string `key:"database.name" env:"DB_NAME"`
+	DBHost     string `key:"database.host" env:"DB_HOST" default:"localhost"`
+	DBPort     int    `key:"database.port" env:"DB_PORT" default:"5432"`
+	// disable, allow, prefer, require, verify-ca or verify-full
+	DBSSLMode string `key:"database.sslmode" env:"DB_SSLMODE" default:"disable"`
+	// Sizes of the connection pool and how long its connections are kept
+	DBMaxOpenConns    int           `key:"database.max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"20"`
+	DBMaxIdleConns    int           `key:"database.max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"2"`
+	DBConnMaxLifetime time.Duration `key:"database.conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"15m"`
+
+	// Apply the pending migrations when the server starts
+	AutoMigrate bool `key:"database.auto_migrate" env:"DB_AUTO_MIGRATE" default:"true"`
+	// Load the demo data after migrating
+	SeedData bool `key:"database.seed" env:"DB_SEED" default:"false"`
+
+	// Keys of the bearer tokens, authentication is turned off when none is set
+	JWTSecret        string `key:"auth.jwt_secret" env:"AUTH_JWT_SECRET" secret:"true"`
+	JWTPublicKeyFile string `key:"auth.jwt_public_key_file" env:"AUTH_JWT_PUBLIC_KEY_FILE"`
+	JWKSFile         string `key:"auth.jwks_file" env:"AUTH_JWKS_FILE"`
+	// Expected issuer and audience of the tokens, not checked when empty
+	JWTIssuer   string `key:"auth.jwt_issuer" env:"AUTH_JWT_ISSUER"`
+	JWTAudience string `key:"auth.jwt_audience" env:"AUTH_JWT_AUDIENCE"`
+
+	// Accept the API keys of services, which turns authentication on
+	APIKeys bool `key:"auth.api_keys" env:"AUTH_API_KEYS" default:"false"`
+
+	// Limit of every route as parsed by ratelimit.ParseLimit, "off" turns rate limiting off
+	RateLimit string `key:"rate_limit.default" env:"RATE_LIMIT" default:"120/m"`
+	// Limits of single routes as parsed by ratelimit.ParseRoutes
+	RateLimitRoutes string `key:"rate_limit.routes" env:"RATE_LIMIT_ROUTES" default:"POST /multiple/favorites/{user_id}=10/m"`
+	// Limit of each client IP across the routes, checked before authentication, "off" turns it off
+	RateLimitIP string `key:"rate_limit.ip" env:"RATE_LIMIT_IP" default:"600/m"`
+	// Where the buckets are kept, memory for each replica or postgres to share them
+	RateLimitBackend string `key:"rate_limit.backend" env:"RATE_LIMIT_BACKEND" default:"memory"`
+	// Tell clients apart by X-Forwarded-For, only when the app runs behind a proxy
+	RateLimitTrustProxy bool `key:"rate_limit.trust_proxy" env:"RATE_LIMIT_TRUST_PROXY" default:"false"`
+
+	// debug, info, warn or error
+	LogLevel string `key:"logging.level" env:"LOG_LEVEL" default:"info"`
+	// json or text
+	LogFormat string `key:"logging.format" env:"LOG_FORMAT" default:"json"`
+	// Leave the asset payloads out of the logs
+	LogRedactData bool `key:"logging.redact_data" env:"LOG_REDACT_DATA" default:"true"`
+
+	// Where the spans are exported to: none, otlp, stdout or file
+	TracingExporter string `key:"tracing.exporter" env:"TRACING_EXPORTER" default:"none"`
+	// URL of the OTLP/HTTP collector, the OTEL_EXPORTER_OTLP_* env vars apply when it is empty
+	TracingEndpoint string `key:"tracing.otlp_endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	// File the file exporter appends the spans to
+	TracingFile string `key:"tracing.file" env:"TRACING_FILE" default:"traces.jsonl"`
+	// Fraction of the traces that are sampled
+	TracingSampleRatio float64 `key:"tracing.sample_ratio" env:"TRACING_SAMPLE_RATIO" default:"1"`
+
+	// Features that can be turned off
+	SearchEnabled   bool `key:"features.search" env:"FEATURE_SEARCH" default:"true"`
+	AdminAPIEnabled bool `key:"features.admin_api" env:"FEATURE_ADMIN_API" default:"true"`
+	MetricsEnabled  bool `key:"features.metrics" env:"FEATURE_METRICS" default:"true"`
+}
+
+// Tells whether a key to check bearer tokens with is configured
+func (cfg *Config) JWTEnabled() bool {
+	return cfg.JWTSecret != "" || cfg.JWTPublicKeyFile != "" || cfg.JWKSFile != ""
 }
 
-func LoadConfig() *Config {
-	return &Config{
-		DBUsername: os.Getenv("DB_USERNAME"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		DBName:     os.Getenv("DB_NAME"),
-		DBHost:     os.Getenv("DB_HOST"),
-		DBPort:     os.Getenv("DB_PORT"),
-	}
+// Tells whether requests must be authenticated
+func (cfg *Config) AuthEnabled() bool {
+	return cfg.JWTEnabled() || cfg.APIKeys
 }
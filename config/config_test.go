@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Settings every test needs, the postgres backend requires them
+func setRequired(t *testing.T) {
+	t.Setenv("DB_NAME", "favorites")
+	t.Setenv("DB_USERNAME", "favorites")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	setRequired(t)
+	cfg, args, err := Load([]string{"up"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"up"}, args)
+	assert.Equal(t, ":8080", cfg.HTTPAddr)
+	assert.Equal(t, 5432, cfg.DBPort)
+	assert.Equal(t, "disable", cfg.DBSSLMode)
+	assert.Equal(t, 20, cfg.DBMaxOpenConns)
+	assert.Equal(t, 15*time.Minute, cfg.DBConnMaxLifetime)
+	assert.Equal(t, 5*time.Second, cfg.RequestTimeout)
+	assert.Equal(t, 3, cfg.RetryMaxAttempts)
+	assert.Equal(t, 100, cfg.MaxPageSize)
+	assert.True(t, cfg.AutoMigrate)
+	assert.True(t, cfg.SearchEnabled)
+	assert.Equal(t, 1.0, cfg.TracingSampleRatio)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	setRequired(t)
+	file := writeFile(t, "favorites.yaml", `
+server:
+  addr: ":7070"
+database:
+  host: db
+  port: 6432
+  max_open_conns: 50
+features:
+  search: false
+`)
+	t.Setenv("DB_HOST", "replica")
+	t.Setenv("DB_MAX_OPEN_CONNS", "")
+
+	cfg, _, err := Load([]string{"--config", file, "--database.port=7432", "--features.admin_api=false"})
+	require.NoError(t, err)
+
+	assert.Equal(t, ":7070", cfg.HTTPAddr, "the file overrides the default")
+	assert.Equal(t, "replica", cfg.DBHost, "the env overrides the file")
+	assert.Equal(t, 50, cfg.DBMaxOpenConns, "an empty env var is ignored")
+	assert.Equal(t, 7432, cfg.DBPort, "the flags override everything")
+	assert.False(t, cfg.SearchEnabled)
+	assert.False(t, cfg.AdminAPIEnabled)
+}
+
+func TestLoad_TOML(t *testing.T) {
+	setRequired(t)
+	t.Setenv(FileEnv, writeFile(t, "favorites.toml", `
+[timeouts]
+default = "2s"
+routes = "GET /favorites/{user_id}=1s"
+
+[retry]
+max_attempts = 5
+`))
+
+	cfg, _, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, cfg.RequestTimeout)
+	assert.Equal(t, 5, cfg.RetryMaxAttempts)
+
+	routes, err := ParseRouteTimeouts(cfg.RouteTimeouts)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"GET /favorites/{user_id}": time.Second}, routes)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	setRequired(t)
+
+	_, _, err := Load([]string{"--config", writeFile(t, "favorites.yaml", "database:\n  hots: db\n")})
+	assert.ErrorContains(t, err, "database.hots: unknown setting")
+
+	_, _, err = Load([]string{"--database.port=fivefour"})
+	assert.ErrorContains(t, err, `--database.port: invalid integer "fivefour"`)
+
+	t.Setenv("REQUEST_TIMEOUT", "5")
+	_, _, err = Load(nil)
+	assert.ErrorContains(t, err, "REQUEST_TIMEOUT: invalid duration")
+}
+
+func TestValidate(t *testing.T) {
+	setRequired(t)
+	t.Setenv("DB_SSLMODE", "sometimes")
+	t.Setenv("DB_MAX_IDLE_CONNS", "50")
+	t.Setenv("PAGINATION_MAX_PAGE_SIZE", "5")
+	t.Setenv("REQUEST_TIMEOUT_ROUTES", "GET /favorites/{user_id}")
+
+	_, _, err := Load(nil)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `database.sslmode (DB_SSLMODE): must be one of disable, allow, prefer, require, verify-ca, verify-full, got "sometimes"`)
+	assert.ErrorContains(t, err, "database.max_idle_conns (DB_MAX_IDLE_CONNS): must not exceed database.max_open_conns 20, got 50")
+	assert.ErrorContains(t, err, "pagination.max_page_size (PAGINATION_MAX_PAGE_SIZE): must be at least the default page size 10, got 5")
+	assert.ErrorContains(t, err, "timeouts.routes (REQUEST_TIMEOUT_ROUTES): invalid route timeout")
+
+	// The database is only needed by the postgres backend
+	t.Setenv("DB_NAME", "")
+	t.Setenv("DB_SSLMODE", "")
+	t.Setenv("DB_MAX_IDLE_CONNS", "")
+	t.Setenv("PAGINATION_MAX_PAGE_SIZE", "")
+	t.Setenv("REQUEST_TIMEOUT_ROUTES", "")
+	_, _, err = Load(nil)
+	assert.ErrorContains(t, err, "database.name (DB_NAME): is required with the postgres backend")
+	_, _, err = Load([]string{"--storage.backend=memory"})
+	assert.NoError(t, err)
+}
+
+func TestPrint(t *testing.T) {
+	setRequired(t)
+	t.Setenv("DB_PASSWORD", "hunter2")
+	t.Setenv("AUTH_JWT_SECRET", "signing-secret")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "90s")
+	cfg, _, err := Load(nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, cfg.Print(&out))
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.NotContains(t, out.String(), "signing-secret")
+	assert.Contains(t, out.String(), "password: '[redacted]' # env DB_PASSWORD")
+	assert.Contains(t, out.String(), "conn_max_lifetime: 1m30s # env DB_CONN_MAX_LIFETIME")
+
+	// The printed config loads back into the same one, but for the secrets
+	t.Setenv("DB_PASSWORD", "")
+	t.Setenv("AUTH_JWT_SECRET", "")
+	printed, _, err := Load([]string{"--config", writeFile(t, "printed.yaml", out.String())})
+	require.NoError(t, err)
+	assert.Equal(t, Redacted, printed.DBPassword)
+	printed.DBPassword, printed.JWTSecret = cfg.DBPassword, cfg.JWTSecret
+	assert.Equal(t, cfg, printed)
+}
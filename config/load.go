@@ -0,0 +1,230 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Env var naming the config file, the --config flag takes precedence over it
+const FileEnv = "CONFIG_FILE"
+
+// setting is a field of Config along with where it is read from
+type setting struct {
+	key    string
+	env    string
+	def    string
+	secret bool
+	value  reflect.Value
+}
+
+// Returns the settings of the fields of cfg, in the order they are declared
+func settings(cfg *Config) []setting {
+	value := reflect.ValueOf(cfg).Elem()
+	var all []setting
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		all = append(all, setting{
+			key:    field.Tag.Get("key"),
+			env:    field.Tag.Get("env"),
+			def:    field.Tag.Get("default"),
+			secret: field.Tag.Get("secret") == "true",
+			value:  value.Field(i),
+		})
+	}
+	return all
+}
+
+// Loads the config, each source overriding the ones before it: the defaults, the file named by
+// --config or CONFIG_FILE, the env vars and the flags. It returns the arguments left after the flags
+// and fails when a value can't be parsed or the config is invalid.
+func Load(args []string) (*Config, []string, error) {
+	cfg, args, err := Read(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, args, nil
+}
+
+// Reads the config like Load without checking it, it only fails when a value can't be parsed
+func Read(args []string) (*Config, []string, error) {
+	cfg := &Config{}
+	all := settings(cfg)
+	for _, s := range all {
+		if s.def == "" {
+			continue
+		}
+		if err := s.set(s.def); err != nil {
+			return nil, nil, fmt.Errorf("default of %s: %w", s.key, err)
+		}
+	}
+
+	// The flags are parsed first to find the file, but applied last
+	flags := flag.NewFlagSet("favorites", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv(FileEnv), "YAML or TOML file to read the config from (env "+FileEnv+")")
+	flagValues := make(map[string]string)
+	for _, s := range all {
+		key := s.key
+		usage := "sets " + key + " (env " + s.env + ")"
+		record := func(value string) error {
+			flagValues[key] = value
+			return nil
+		}
+		if s.value.Kind() == reflect.Bool {
+			flags.BoolFunc(key, usage, record)
+		} else {
+			flags.Func(key, usage, record)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *file != "" {
+		values, err := readFile(*file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := apply(all, values, func(key string) string { return *file + ": " + key }); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, s := range all {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			if err := s.set(value); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	if err := apply(all, flagValues, func(key string) string { return "--" + key }); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// Sets the settings named by the keys of values, name tells where a key comes from in the errors
+func apply(all []setting, values map[string]string, name func(key string) string) error {
+	byKey := make(map[string]setting, len(all))
+	for _, s := range all {
+		byKey[s.key] = s
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("%s: unknown setting", name(key))
+		}
+		if err := s.set(values[key]); err != nil {
+			return fmt.Errorf("%s: %w", name(key), err)
+		}
+	}
+	return nil
+}
+
+// Parses the value as the type of the field and sets it
+func (s setting) set(value string) error {
+	value = strings.TrimSpace(value)
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q, expected true or false", value)
+		}
+		s.value.SetBool(b)
+	case reflect.Int64:
+		if s.value.Type() != reflect.TypeOf(time.Duration(0)) {
+			return fmt.Errorf("unsupported type %s", s.value.Type())
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected a number with a unit such as 500ms, 10s or 1m", value)
+		}
+		s.value.SetInt(int64(d))
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		s.value.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		s.value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", s.value.Type())
+	}
+	return nil
+}
+
+// Reads a YAML or TOML file, told apart by their extension, into the values of its dotted keys
+func readFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	document := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &document)
+	case ".toml":
+		err = toml.Unmarshal(content, &document)
+	default:
+		return nil, fmt.Errorf("%s: unknown config file format, expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flatten("", document, values); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// Adds the values of the nested tables of document to values, under their dotted keys
+func flatten(prefix string, document map[string]any, values map[string]string) error {
+	for key, value := range document {
+		key = prefix + key
+		switch value := value.(type) {
+		case map[string]any:
+			if err := flatten(key+".", value, values); err != nil {
+				return err
+			}
+		case string:
+			values[key] = value
+		case bool, int, int64, uint64, float64:
+			values[key] = fmt.Sprint(value)
+		case nil:
+			// An empty value leaves the setting as it is
+		default:
+			return errors.New(key + ": expected a string, a number or a boolean")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Value the secrets are printed with
+const Redacted = "[redacted]"
+
+// Writes the config as a YAML file that Load can read back, with the secrets redacted
+func (cfg *Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := make(map[string]*yaml.Node)
+	for _, s := range settings(cfg) {
+		section, name, _ := strings.Cut(s.key, ".")
+		if sections[section] == nil {
+			sections[section] = &yaml.Node{Kind: yaml.MappingNode}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: section}, sections[section])
+		}
+
+		value := &yaml.Node{}
+		if err := value.Encode(printable(s)); err != nil {
+			return err
+		}
+		value.LineComment = "env " + s.env
+		sections[section].Content = append(sections[section].Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Returns the value of the setting as it is printed, durations are written as Load reads them
+func printable(s setting) any {
+	if s.secret && !s.value.IsZero() {
+		return Redacted
+	}
+	if s.value.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(s.value.Int()).String()
+	}
+	return s.value.Interface()
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/ratelimit"
+	"github.com/arhsxro/platform-go-challenge/tracing"
+)
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Collects the problems of a config, each one names the setting and its env var
+type validator struct {
+	envs     map[string]string
+	problems []error
+}
+
+// Records a problem with the setting of the key unless ok
+func (v *validator) check(ok bool, key, format string, args ...any) {
+	if !ok {
+		v.problems = append(v.problems, fmt.Errorf("%s (%s): %s", key, v.envs[key], fmt.Sprintf(format, args...)))
+	}
+}
+
+// Returns every problem of the config at once, nil when there is none
+func (cfg *Config) Validate() error {
+	v := &validator{envs: make(map[string]string)}
+	for _, s := range settings(cfg) {
+		v.envs[s.key] = s.env
+	}
+
+	v.check(cfg.HTTPAddr != "", "server.addr", "is required")
+	v.check((cfg.TLSCertFile == "") == (cfg.TLSKeyFile == ""), "server.tls_cert_file", "a TLS certificate and key go together, set both or neither")
+	for _, file := range []struct{ key, path string }{
+		{"server.tls_cert_file", cfg.TLSCertFile},
+		{"server.tls_key_file", cfg.TLSKeyFile},
+	} {
+		if file.path != "" {
+			_, err := os.Stat(file.path)
+			v.check(err == nil, file.key, "%v", err)
+		}
+	}
+	for _, timeout := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"server.read_timeout", cfg.ReadTimeout},
+		{"server.read_header_timeout", cfg.ReadHeaderTimeout},
+		{"server.write_timeout", cfg.WriteTimeout},
+		{"server.idle_timeout", cfg.IdleTimeout},
+		{"server.shutdown_delay", cfg.ShutdownDelay},
+	} {
+		v.check(timeout.value >= 0, timeout.key, "must not be negative, got %s", timeout.value)
+	}
+	v.check(cfg.ShutdownGracePeriod > 0, "server.shutdown_grace_period", "must be positive, got %s", cfg.ShutdownGracePeriod)
+
+	v.check(cfg.RequestTimeout > 0, "timeouts.default", "must be positive, got %s", cfg.RequestTimeout)
+	_, err := ParseRouteTimeouts(cfg.RouteTimeouts)
+	v.check(err == nil, "timeouts.routes", "%v", err)
+
+	v.check(cfg.RetryMaxAttempts >= 1, "retry.max_attempts", "must be at least 1, got %d", cfg.RetryMaxAttempts)
+	v.check(cfg.RetryBackoff >= 0, "retry.backoff", "must not be negative, got %s", cfg.RetryBackoff)
+
+	v.check(cfg.DefaultPageSize >= 1, "pagination.default_page_size", "must be at least 1, got %d", cfg.DefaultPageSize)
+	v.check(cfg.MaxPageSize >= cfg.DefaultPageSize, "pagination.max_page_size", "must be at least the default page size %d, got %d", cfg.DefaultPageSize, cfg.MaxPageSize)
+
+	v.check(cfg.BulkMaxBatchSize >= 1, "bulk.max_batch_size", "must be at least 1, got %d", cfg.BulkMaxBatchSize)
+	v.check(cfg.BulkConcurrency >= 1, "bulk.concurrency", "must be at least 1, got %d", cfg.BulkConcurrency)
+
+	v.check(cfg.StorageBackend == PostgresBackend || cfg.StorageBackend == MemoryBackend, "storage.backend", "must be %s or %s, got %q", PostgresBackend, MemoryBackend, cfg.StorageBackend)
+	if cfg.StorageBackend == PostgresBackend {
+		v.check(cfg.DBName != "", "database.name", "is required with the postgres backend")
+		v.check(cfg.DBUsername != "", "database.username", "is required with the postgres backend")
+		v.check(cfg.DBHost != "", "database.host", "is required with the postgres backend")
+		v.check(cfg.DBPort >= 1 && cfg.DBPort <= 65535, "database.port", "must be between 1 and 65535, got %d", cfg.DBPort)
+		v.check(slices.Contains(sslModes, cfg.DBSSLMode), "database.sslmode", "must be one of %s, got %q", strings.Join(sslModes, ", "), cfg.DBSSLMode)
+		v.check(cfg.DBMaxOpenConns >= 0, "database.max_open_conns", "must not be negative, 0 means no limit, got %d", cfg.DBMaxOpenConns)
+		v.check(cfg.DBMaxIdleConns >= 0, "database.max_idle_conns", "must not be negative, got %d", cfg.DBMaxIdleConns)
+		v.check(cfg.DBMaxOpenConns == 0 || cfg.DBMaxIdleConns <= cfg.DBMaxOpenConns, "database.max_idle_conns", "must not exceed database.max_open_conns %d, got %d", cfg.DBMaxOpenConns, cfg.DBMaxIdleConns)
+		v.check(cfg.DBConnMaxLifetime >= 0, "database.conn_max_lifetime", "must not be negative, 0 means forever, got %s", cfg.DBConnMaxLifetime)
+	}
+
+	if cfg.RateLimit != "off" && cfg.RateLimit != "" {
+		_, err := ratelimit.ParseLimit(cfg.RateLimit)
+		v.check(err == nil, "rate_limit.default", "%v", err)
+	}
+	if cfg.RateLimitIP != "off" && cfg.RateLimitIP != "" {
+		_, err := ratelimit.ParseLimit(cfg.RateLimitIP)
+		v.check(err == nil, "rate_limit.ip", "%v", err)
+	}
+	_, err = ratelimit.ParseRoutes(cfg.RateLimitRoutes)
+	v.check(err == nil, "rate_limit.routes", "%v", err)
+	v.check(cfg.RateLimitBackend == MemoryBackend || cfg.RateLimitBackend == PostgresBackend, "rate_limit.backend", "must be %s or %s, got %q", MemoryBackend, PostgresBackend, cfg.RateLimitBackend)
+	v.check(cfg.RateLimitBackend != PostgresBackend || cfg.StorageBackend == PostgresBackend, "rate_limit.backend", "postgres needs the postgres storage backend")
+
+	_, err = logging.ParseLevel(cfg.LogLevel)
+	v.check(err == nil, "logging.level", "%v", err)
+	v.check(cfg.LogFormat == logging.JSONFormat || cfg.LogFormat == logging.TextFormat, "logging.format", "must be %s or %s, got %q", logging.JSONFormat, logging.TextFormat, cfg.LogFormat)
+
+	exporters := []string{tracing.NoExporter, tracing.OTLPExporter, tracing.StdoutExporter, tracing.FileExporter}
+	v.check(slices.Contains(exporters, cfg.TracingExporter), "tracing.exporter", "must be one of %s, got %q", strings.Join(exporters, ", "), cfg.TracingExporter)
+	v.check(cfg.TracingExporter != tracing.FileExporter || cfg.TracingFile != "", "tracing.file", "is required with the file exporter")
+	v.check(cfg.TracingSampleRatio >= 0 && cfg.TracingSampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1, got %g", cfg.TracingSampleRatio)
+
+	return errors.Join(v.problems...)
+}
+
+// Parses the timeouts of single routes, written "<METHOD> <path template>=<duration>" and separated by ";".
+// For example "POST /multiple/favorites/{user_id}=30s;GET /favorites/{user_id}=2s".
+func ParseRouteTimeouts(value string) (map[string]time.Duration, error) {
+	routes := make(map[string]time.Duration)
+	for _, rule := range strings.Split(value, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		route, durationStr, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route timeout %q, expected <METHOD> <path>=<duration>", rule)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(durationStr))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout in route timeout %q, expected a positive duration such as 10s", rule)
+		}
+		routes[strings.Join(strings.Fields(route), " ")] = timeout
+	}
+	return routes, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/arhsxro/platform-go-challenge/config"
+)
+
+const configUsage = `usage: main config <command>
+
+commands:
+  print      print the config as loaded from the defaults, the file, the env and the flags, secrets redacted,
+             then the problems found when checking it`
+
+// Runs the config subcommand. The config is read without being checked first, so that an invalid
+// config can still be printed, its problems are returned after it.
+func runConfig(args []string, stdout io.Writer) error {
+	cfg, args, err := config.Read(args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+	if err := cfg.Print(stdout); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	return nil
+}
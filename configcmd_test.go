@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunConfig_PrintsAnInvalidConfig(t *testing.T) {
+	t.Setenv("DB_NAME", "")
+	t.Setenv("DB_USERNAME", "favorites")
+	t.Setenv("DB_PASSWORD", "hunter2")
+
+	var out bytes.Buffer
+	err := runConfig([]string{"print"}, &out)
+	assert.ErrorContains(t, err, "database.name (DB_NAME): is required with the postgres backend")
+	assert.Contains(t, out.String(), "username: favorites # env DB_USERNAME")
+	assert.NotContains(t, out.String(), "hunter2")
+
+	out.Reset()
+	t.Setenv("DB_NAME", "favorites")
+	require.NoError(t, runConfig([]string{"print"}, &out))
+	assert.Contains(t, out.String(), "name: favorites # env DB_NAME")
+
+	assert.ErrorContains(t, runConfig([]string{"show"}, &out), "usage: main config <command>")
+}
@@ -0,0 +1,91 @@
+// Package logging writes structured logs with log/slog and carries the logger of a request in its context
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Output formats of the logs
+const (
+	JSONFormat = "json"
+	TextFormat = "text"
+)
+
+// Key of the asset payloads in the logs, its value is replaced when they are redacted
+const DataKey = "data"
+
+// Value the redacted payloads are logged with
+const Redacted = "[redacted]"
+
+type Options struct {
+	// debug, info, warn or error
+	Level  string
+	Format string
+	// Leave the asset payloads out of the logs
+	RedactData bool
+}
+
+// Creates a logger writing to w
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	if opts.RedactData {
+		handlerOptions.ReplaceAttr = redactData
+	}
+
+	switch opts.Format {
+	case JSONFormat, "":
+		return slog.New(slog.NewJSONHandler(w, handlerOptions)), nil
+	case TextFormat:
+		return slog.New(slog.NewTextHandler(w, handlerOptions)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected %q or %q", opts.Format, JSONFormat, TextFormat)
+	}
+}
+
+// Parses a level name, info when empty
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if strings.TrimSpace(value) == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+// Replaces the payloads, at any depth, with a placeholder
+func redactData(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key == DataKey {
+		return slog.String(DataKey, Redacted)
+	}
+	return attr
+}
+
+type contextKey struct{}
+
+// Returns a copy of ctx carrying the logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// Returns the logger of ctx, the default logger when it has none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Returns a copy of ctx whose logger adds the attributes to every line
+func With(ctx context.Context, args ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(args...))
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_Level(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := New(&logs, Options{Level: "warn"})
+	require.NoError(t, err)
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.Equal(t, "WARN", line["level"])
+	assert.Equal(t, "shown", line["msg"])
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, Options{Level: "loud"})
+	assert.Error(t, err)
+
+	_, err = New(&bytes.Buffer{}, Options{Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestNew_RedactData(t *testing.T) {
+	payload := slog.Group("asset", slog.String("id", "chart1"), slog.String(DataKey, `{"points": [1, 2]}`))
+
+	var logs bytes.Buffer
+	logger, err := New(&logs, Options{RedactData: true})
+	require.NoError(t, err)
+	logger.Info("adding favorite", payload)
+	assert.JSONEq(t, `{"id": "chart1", "data": "[redacted]"}`, string(field(t, logs.Bytes(), "asset")))
+
+	logs.Reset()
+	logger, err = New(&logs, Options{})
+	require.NoError(t, err)
+	logger.Info("adding favorite", payload)
+	assert.JSONEq(t, `{"id": "chart1", "data": "{\"points\": [1, 2]}"}`, string(field(t, logs.Bytes(), "asset")))
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, slog.Default(), FromContext(context.Background()))
+
+	var logs bytes.Buffer
+	logger, err := New(&logs, Options{})
+	require.NoError(t, err)
+	ctx := With(NewContext(context.Background(), logger), slog.String("request_id", "request-1"))
+
+	FromContext(ctx).Info("served")
+	assert.Equal(t, `"request-1"`, string(field(t, logs.Bytes(), "request_id")))
+}
+
+// Returns the raw value of a field of a JSON log line
+func field(t *testing.T, line []byte, key string) json.RawMessage {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(line, &fields))
+	return fields[key]
+}
@@ -1,42 +1,311 @@
 package main
 
 import (
-	"log"
-	"net/http"
-	"strconv"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/arhsxro/platform-go-challenge/api"
+	"github.com/arhsxro/platform-go-challenge/auth"
 	"github.com/arhsxro/platform-go-challenge/config"
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/metrics"
+	"github.com/arhsxro/platform-go-challenge/migrations"
+	"github.com/arhsxro/platform-go-challenge/ratelimit"
 	"github.com/arhsxro/platform-go-challenge/storage"
+	"github.com/arhsxro/platform-go-challenge/tracing"
+	"github.com/arhsxro/platform-go-challenge/utils"
 )
 
+// Subcommands of the app, it serves the API without one. The config subcommand runs apart,
+// before the config is checked.
+var commands = map[string]func(cfg *config.Config, args []string) error{
+	"migrate": runMigrate,
+	"apikey":  runAPIKey,
+}
+
 func main() {
 
-	cfg := config.LoadConfig()
+	// The flags of the config come after the subcommand, its own arguments after them
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "config" {
+		err := runConfig(args[1:], os.Stdout)
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	command := ""
+	if len(args) > 0 && commands[args[0]] != nil {
+		command, args = args[0], args[1:]
+	}
+	cfg, args, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	// The standard logger writes through it as well once it is the default
+	logger, err := logging.New(os.Stdout, logging.Options{Level: cfg.LogLevel, Format: cfg.LogFormat, RedactData: cfg.LogRedactData})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	// The app exits once run returned, after its deferred shutdowns
+	if err := run(cfg, logger, command, args); err != nil {
+		slog.Error("the app failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+// Runs the subcommand, or serves the API until the app is told to stop
+func run(cfg *config.Config, logger *slog.Logger, command string, args []string) error {
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		File:        cfg.TracingFile,
+		ServiceName: "favorites",
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	if command != "" {
+		if err := commands[command](cfg, args); err != nil {
+			return fmt.Errorf("%s command failed: %w", command, err)
+		}
+		return nil
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unknown command %q, expected migrate, apikey or config", args[0])
+	}
+
+	// Initialize storage
+	var dbInstance storage.Store
+	switch cfg.StorageBackend {
+	case config.PostgresBackend:
+		postgresStore, err := connectPostgres(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to connect to database: %w", err)
+		}
+		dbInstance = postgresStore
+		if cfg.AutoMigrate {
+			if err := migrateUp(context.Background(), postgresStore, cfg.SeedData); err != nil {
+				postgresStore.Close()
+				return fmt.Errorf("failed to migrate the database: %w", err)
+			}
+		}
+		if err := metrics.RegisterDBStats(postgresStore.DB().DB, "favorites"); err != nil {
+			postgresStore.Close()
+			return fmt.Errorf("failed to register the connection pool metrics: %w", err)
+		}
+	case config.MemoryBackend:
+		slog.Warn("using the in-memory store, the favorites are lost when the app stops")
+		dbInstance = storage.NewMemoryStore()
+	default:
+		return fmt.Errorf("unknown storage backend %q, expected %q or %q", cfg.StorageBackend, config.PostgresBackend, config.MemoryBackend)
+	}
+	// No request uses the store anymore once serve returned
+	defer func() {
+		if err := dbInstance.Close(); err != nil {
+			slog.Error("failed to close the store", slog.Any("error", err))
+		}
+	}()
+
+	apiOptions, err := authOptions(cfg, dbInstance)
+	if err != nil {
+		return fmt.Errorf("failed to set up authentication: %w", err)
+	}
+	rateLimitOptions, err := rateLimitOptions(cfg, dbInstance)
+	if err != nil {
+		return fmt.Errorf("failed to set up rate limiting: %w", err)
+	}
+	apiOptions = append(apiOptions, rateLimitOptions...)
+	readinessOptions, err := readinessOptions(dbInstance)
+	if err != nil {
+		return fmt.Errorf("failed to set up the readiness checks: %w", err)
+	}
+	apiOptions = append(apiOptions, readinessOptions...)
+
+	// Initialize API with the storage instance, measuring every operation
+	settingsOptions, err := settingsOptions(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up the API: %w", err)
+	}
+	apiOptions = append(apiOptions, settingsOptions...)
+	apiInstance := api.InitApi(storage.NewInstrumentedStore(dbInstance), append(apiOptions, api.WithLogger(logger))...)
+	router := apiInstance.InitRoutes()
+
+	listener, err := net.Listen("tcp", cfg.HTTPAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.HTTPAddr, err)
+	}
+	// A second signal stops the app right away, since the context stops listening for them once done
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serve(ctx, cfg, newServer(cfg, router), listener, func() {
+		stop()
+		apiInstance.StartShutdown()
+	}); err != nil {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	slog.Info("stopped")
+	return nil
+}
+
+// Returns the API options turning authentication on, as configured
+func authOptions(cfg *config.Config, dbInstance storage.Store) ([]api.Option, error) {
+	if !cfg.AuthEnabled() {
+		slog.Warn("authentication is turned off, anyone can act on any user")
+		return nil, nil
+	}
+
+	var options []api.Option
+	var authenticators auth.Chain
+	if cfg.JWTEnabled() {
+		authenticator, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+			HMACSecret:       []byte(cfg.JWTSecret),
+			RSAPublicKeyFile: cfg.JWTPublicKeyFile,
+			JWKSFile:         cfg.JWKSFile,
+			Issuer:           cfg.JWTIssuer,
+			Audience:         cfg.JWTAudience,
+		})
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	if cfg.APIKeys {
+		keys, ok := dbInstance.(storage.APIKeyStore)
+		if !ok {
+			return nil, errors.New("the storage backend does not support api keys")
+		}
+		authenticators = append(authenticators, auth.NewAPIKeyAuthenticator(keys))
+		options = append(options, api.WithAPIKeys(keys))
+	}
+
+	return append(options, api.WithAuthenticator(authenticators)), nil
+}
 
-	// Initialize database
+// Returns the API options turning rate limiting on, as configured
+func rateLimitOptions(cfg *config.Config, dbInstance storage.Store) ([]api.Option, error) {
+	if cfg.RateLimit == "off" {
+		slog.Info("rate limiting is turned off")
+		return nil, nil
+	}
+
+	var rules ratelimit.Rules
+	if cfg.RateLimit != "" {
+		limit, err := ratelimit.ParseLimit(cfg.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		rules.Default = &limit
+	}
+	if cfg.RateLimitIP != "off" && cfg.RateLimitIP != "" {
+		limit, err := ratelimit.ParseLimit(cfg.RateLimitIP)
+		if err != nil {
+			return nil, err
+		}
+		rules.IP = &limit
+	}
+	routes, err := ratelimit.ParseRoutes(cfg.RateLimitRoutes)
+	if err != nil {
+		return nil, err
+	}
+	rules.Routes = routes
+
+	var backend ratelimit.Backend
+	switch cfg.RateLimitBackend {
+	case config.MemoryBackend:
+		backend = ratelimit.NewMemoryBackend()
+	case config.PostgresBackend:
+		postgresStore, ok := dbInstance.(*storage.PostgresStore)
+		if !ok {
+			return nil, errors.New("the postgres rate limit backend needs the postgres storage backend")
+		}
+		backend = ratelimit.NewPostgresBackend(postgresStore.DB())
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q, expected %q or %q", cfg.RateLimitBackend, config.MemoryBackend, config.PostgresBackend)
+	}
+
+	return []api.Option{api.WithRateLimiter(ratelimit.NewLimiter(backend, rules), cfg.RateLimitTrustProxy)}, nil
+}
+
+// Returns the API options of the timeouts, the retries, the pagination and the features, as configured
+func settingsOptions(cfg *config.Config) ([]api.Option, error) {
+	routeTimeouts, err := config.ParseRouteTimeouts(cfg.RouteTimeouts)
+	if err != nil {
+		return nil, err
+	}
+	return []api.Option{
+		api.WithTimeouts(api.Timeouts{Default: cfg.RequestTimeout, Routes: routeTimeouts}),
+		api.WithRetryPolicy(utils.RetryPolicy{MaxAttempts: cfg.RetryMaxAttempts, Backoff: cfg.RetryBackoff}),
+		api.WithPagination(cfg.DefaultPageSize, cfg.MaxPageSize),
+		api.WithBulkLimits(cfg.BulkMaxBatchSize, cfg.BulkConcurrency),
+		api.WithFeatures(api.Features{Search: cfg.SearchEnabled, AdminAPI: cfg.AdminAPIEnabled, Metrics: cfg.MetricsEnabled}),
+	}, nil
+}
+
+// Returns the API options adding the readiness checks of the storage backend, the storage itself is always checked
+func readinessOptions(dbInstance storage.Store) ([]api.Option, error) {
+	postgresStore, ok := dbInstance.(*storage.PostgresStore)
+	if !ok {
+		return nil, nil
+	}
+	// An instance running on an older schema than its code expects is not ready
+	migrator, err := migrations.New(postgresStore.DB())
+	if err != nil {
+		return nil, err
+	}
+	return []api.Option{api.WithReadinessCheck("migrations", migrator.CheckApplied)}, nil
+}
+
+// Connects to the database, retrying while it is starting up
+func connectPostgres(cfg *config.Config) (*storage.PostgresStore, error) {
 	maxAttempts := 5
 	var err error
 	var dbInstance *storage.PostgresStore
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		dbInstance, err = storage.NewPostgresStore(cfg)
 		if err == nil {
-			break
+			return dbInstance, nil
 		}
-		log.Println("Attempt "+strconv.Itoa(attempt)+": Failed to connect to database: ", err)
+		slog.Warn("failed to connect to the database", slog.Int("attempt", attempt), slog.Any("error", err))
 		if attempt < maxAttempts {
 			time.Sleep(time.Duration(attempt) * time.Second)
 		}
 	}
+	return nil, err
+}
+
+// Applies the pending migrations and optionally loads the demo data
+func migrateUp(ctx context.Context, dbInstance *storage.PostgresStore, seed bool) error {
+	migrator, err := migrations.New(dbInstance.DB())
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return err
 	}
-	defer dbInstance.Close()
-
-	// Initialize API with the database instance
-	apiInstance := api.InitApi(dbInstance)
-	router := apiInstance.InitRoutes()
-
-	http.ListenAndServe(":8080", router)
+	if err := migrator.Up(ctx); err != nil {
+		return err
+	}
+	if seed {
+		slog.Info("loading the demo data")
+		return migrations.Seed(ctx, dbInstance.DB())
+	}
+	return nil
 }
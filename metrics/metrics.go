@@ -0,0 +1,81 @@
+// Package metrics exposes the Prometheus metrics of the service
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "favorites"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests served, by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve the HTTP requests, by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Time taken by the storage operations, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	storageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_errors_total",
+		Help:      "Number of storage operations that failed, by method.",
+	}, []string{"operation"})
+
+	retryAttempts = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "retry_attempts",
+		Help:      "Number of attempts made by the retried operations, by outcome.",
+		Buckets:   []float64{1, 2, 3, 5},
+	}, []string{"outcome"})
+)
+
+// Serves the metrics in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Records a served HTTP request, the route is the path template so that the number of series stays bounded
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	statusLabel := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, statusLabel).Inc()
+	httpDuration.WithLabelValues(method, route, statusLabel).Observe(duration.Seconds())
+}
+
+// Records a storage operation, failed ones are counted as errors too
+func ObserveStorage(operation string, duration time.Duration, err error) {
+	storageDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err != nil {
+		storageErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// Records the number of attempts of a retried operation, the outcome is success, error, permanent or canceled
+func ObserveRetry(attempts int, outcome string) {
+	retryAttempts.WithLabelValues(outcome).Observe(float64(attempts))
+}
+
+// Exposes the stats of a connection pool: open, in use and idle connections, waits and closes
+func RegisterDBStats(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveRequest(t *testing.T) {
+	ObserveRequest("GET", "/favorites/{user_id}", http.StatusOK, 20*time.Millisecond)
+	ObserveRequest("GET", "/favorites/{user_id}", http.StatusOK, 30*time.Millisecond)
+	ObserveRequest("GET", "/favorites/{user_id}", http.StatusBadRequest, time.Millisecond)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/favorites/{user_id}", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/favorites/{user_id}", "400")))
+}
+
+func TestObserveStorage(t *testing.T) {
+	ObserveStorage("AddFavorite", time.Millisecond, nil)
+	ObserveStorage("AddFavorite", time.Millisecond, errors.New("connection refused"))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(storageErrors.WithLabelValues("AddFavorite")))
+}
+
+func TestHandler(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost")
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, RegisterDBStats(db, "favorites_test"))
+
+	ObserveRetry(2, "success")
+	ObserveStorage("GetUserFavorites", time.Millisecond, nil)
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, `favorites_retry_attempts_bucket{outcome="success",le="2"} 1`)
+	assert.Contains(t, body, `favorites_storage_operation_duration_seconds_count{operation="GetUserFavorites"} 1`)
+	assert.Contains(t, body, `go_sql_open_connections{db_name="favorites_test"} 0`)
+	assert.Contains(t, body, `go_sql_wait_count_total{db_name="favorites_test"} 0`)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/arhsxro/platform-go-challenge/config"
+	"github.com/arhsxro/platform-go-challenge/migrations"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  up         apply every pending migration
+  down [n]   revert the last n applied migrations (default 1)
+  status     list the migrations and whether they are applied
+  seed       load the demo data`
+
+// Runs the migrate subcommand
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	dbInstance, err := connectPostgres(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbInstance.Close()
+
+	ctx := context.Background()
+	migrator, err := migrations.New(dbInstance.DB())
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations to revert: %q", args[1])
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	case "seed":
+		return migrations.Seed(ctx, dbInstance.DB())
+	default:
+		return errors.New(migrateUsage)
+	}
+}
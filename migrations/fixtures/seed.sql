@@ -0,0 +1,36 @@
+-- Demo data, loaded on demand and safe to load more than once
+
+-- Insert initial users
+INSERT INTO users (user_id) VALUES
+('user1'),
+('user2'),
+('user3')
+ON CONFLICT (user_id) DO NOTHING;
+
+-- Insert initial assets of the catalog
+INSERT INTO assets (asset_id, type, description, data) VALUES
+('chart1', 'Chart', 'A test chart', '{"title": "Test Chart", "axisTitle": "Test Axis", "data": [0, 1, 2, 3, 4, 5]}'),
+('insight1', 'Insight', 'A test text', '{"text": "40% of millennials spend more than 3 hours on social media daily."}'),
+('audience1', 'Audience', 'A test Audience characteristics', '{"gender": "Male", "birthCountry": "Greece", "ageGroup": "24-35", "socialMediaHours": 3, "purchasesLastMonth": 6}'),
+('chart2', 'Chart', 'A test chart', '{"title": "Another Sample Chart", "axisTitle": "Test Axis", "data": [10, 20, 30, 40, 50]}'),
+('insight2', 'Insight', 'A test text', '{"text": "60% of Gen Z spends more than 5 hours on social media daily."}'),
+('audience2', 'Audience', 'A test Audience characteristics', '{"gender": "Female", "birthCountry": "Canada", "ageGroup": "18-24", "socialMediaHours": 5, "purchasesLastMonth": 10}'),
+('chart3', 'Chart', 'A test chart', '{"title": "Another Sample Chart", "axisTitle": "Test Axis", "data": [500, 0]}'),
+('insight3', 'Insight', 'A test text', '{"text": "90% of the third age spend zero time on social media."}'),
+('audience3', 'Audience', 'A test Audience characteristics', '{"gender": "Male", "birthCountry": "Greece", "ageGroup": "70-80", "socialMediaHours": 0, "purchasesLastMonth": 0}')
+ON CONFLICT (asset_id) DO NOTHING;
+
+-- Insert initial favorites of each user
+INSERT INTO favorites (user_id, asset_id) VALUES
+('user1', 'chart1'),
+('user1', 'insight1'),
+('user1', 'audience1'),
+('user2', 'chart2'),
+('user2', 'insight2'),
+('user2', 'audience2'),
+('user2', 'chart1'),
+('user3', 'chart3'),
+('user3', 'insight3'),
+('user3', 'audience3'),
+('user3', 'chart1')
+ON CONFLICT (user_id, asset_id) DO NOTHING;
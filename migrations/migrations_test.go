@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	migrations, err := load(migrationFiles)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.NotEmpty(t, migration.Up, "migration %d has no up statements", migration.Version)
+		assert.NotEmpty(t, migration.Down, "migration %d has no down statements", migration.Version)
+		if i > 0 {
+			assert.Greater(t, migration.Version, migrations[i-1].Version, "migrations are not sorted by version")
+		}
+	}
+}
+
+func TestLoadRejectsInvalidMigrations(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{
+			name:  "invalid file name",
+			files: fstest.MapFS{"sql/create_users.up.sql": {Data: []byte("SELECT 1")}},
+		},
+		{
+			name:  "missing down file",
+			files: fstest.MapFS{"sql/0001_create_users.up.sql": {Data: []byte("SELECT 1")}},
+		},
+		{
+			name: "version with two names",
+			files: fstest.MapFS{
+				"sql/0001_create_users.up.sql": {Data: []byte("SELECT 1")},
+				"sql/0001_drop_users.down.sql": {Data: []byte("SELECT 1")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.files)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestIsUndefinedTable(t *testing.T) {
+	assert.True(t, isUndefinedTable(fmt.Errorf("reading the migrations: %w", &pq.Error{Code: "42P01"})))
+	assert.False(t, isUndefinedTable(&pq.Error{Code: "42501"}), "a missing privilege is not a missing table")
+	assert.False(t, isUndefinedTable(errors.New(`relation "schema_migrations" does not exist`)))
+	assert.False(t, isUndefinedTable(nil))
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS assets;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,9 @@
+-- Lossy: an asset favorited by several users is given back to the one who favorited it first
+-- and the per-user descriptions are dropped.
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS user_id VARCHAR(50) REFERENCES users(user_id);
+
+UPDATE assets a SET user_id = f.user_id
+FROM (SELECT DISTINCT ON (asset_id) asset_id, user_id FROM favorites ORDER BY asset_id, added_at) f
+WHERE a.asset_id = f.asset_id;
+
+DROP TABLE IF EXISTS favorites;
@@ -0,0 +1,24 @@
+-- Assets become a shared catalog and the favorites of each user move to their own table.
+-- A NULL description means the catalog description is used.
+CREATE TABLE IF NOT EXISTS favorites (
+    user_id VARCHAR(50) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    asset_id VARCHAR(50) NOT NULL REFERENCES assets(asset_id) ON DELETE CASCADE,
+    description TEXT,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, asset_id)
+);
+
+CREATE INDEX IF NOT EXISTS favorites_asset_id_idx ON favorites (asset_id);
+
+-- Databases created by the old init.sql still have the owner of each asset on the assets table
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'assets' AND column_name = 'user_id') THEN
+        INSERT INTO favorites (user_id, asset_id)
+        SELECT user_id, asset_id FROM assets WHERE user_id IS NOT NULL
+        ON CONFLICT (user_id, asset_id) DO NOTHING;
+
+        ALTER TABLE assets DROP COLUMN user_id;
+    END IF;
+END $$;
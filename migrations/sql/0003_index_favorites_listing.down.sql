@@ -0,0 +1 @@
+DROP INDEX IF EXISTS favorites_listing_idx;
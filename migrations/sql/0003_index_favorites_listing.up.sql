@@ -0,0 +1,3 @@
+-- Favorites are listed by the time they were added, then by asset id compared byte by byte.
+-- The index serves both the ORDER BY and the keyset pagination condition.
+CREATE INDEX IF NOT EXISTS favorites_listing_idx ON favorites (user_id, added_at, asset_id COLLATE "C");
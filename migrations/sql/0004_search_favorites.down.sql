@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS favorites_search_document_idx;
+ALTER TABLE favorites DROP COLUMN IF EXISTS search_document;
+
+DROP INDEX IF EXISTS assets_search_document_idx;
+ALTER TABLE assets DROP COLUMN IF EXISTS search_document;
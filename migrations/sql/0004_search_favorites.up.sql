@@ -0,0 +1,17 @@
+-- Full-text search over the description of the assets and the text fields of their data.
+-- Chart titles weigh the most, the descriptions the least.
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS search_document tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(data->>'title', '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(data->>'axisTitle', '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(data->>'text', '')), 'B') ||
+        setweight(to_tsvector('english', description), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS assets_search_document_idx ON assets USING GIN (search_document);
+
+-- The descriptions users give to their favorites are searched too
+ALTER TABLE favorites ADD COLUMN IF NOT EXISTS search_document tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('english', coalesce(description, '')), 'C')) STORED;
+
+CREATE INDEX IF NOT EXISTS favorites_search_document_idx ON favorites USING GIN (search_document);
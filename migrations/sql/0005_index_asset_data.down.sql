@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS assets_type_idx;
+DROP INDEX IF EXISTS assets_data_idx;
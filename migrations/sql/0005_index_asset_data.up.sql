@@ -0,0 +1,5 @@
+-- Serves the containment tests of the audience filters, for example data @> '{"gender": "Female"}'
+CREATE INDEX IF NOT EXISTS assets_data_idx ON assets USING GIN (data jsonb_path_ops);
+
+-- Serves the type filters, which the audience filters imply
+CREATE INDEX IF NOT EXISTS assets_type_idx ON assets (type);
@@ -0,0 +1,19 @@
+ALTER TABLE favorites DROP COLUMN IF EXISTS search_document;
+
+ALTER TABLE favorites ADD COLUMN IF NOT EXISTS search_document tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('english', coalesce(description, '')), 'C')) STORED;
+
+CREATE INDEX IF NOT EXISTS favorites_search_document_idx ON favorites USING GIN (search_document);
+
+ALTER TABLE assets DROP COLUMN IF EXISTS description_search_document;
+ALTER TABLE assets DROP COLUMN IF EXISTS data_search_document;
+
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS search_document tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(data->>'title', '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(data->>'axisTitle', '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(data->>'text', '')), 'B') ||
+        setweight(to_tsvector('english', description), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS assets_search_document_idx ON assets USING GIN (search_document);
@@ -0,0 +1,19 @@
+-- The catalog description of an asset is only searched for the favorites without a description of their own,
+-- so the data and the description of the assets get separate documents and the document of a favorite is
+-- NULL when it has no description. The search combines them per row, which the GIN indexes can't serve.
+ALTER TABLE assets DROP COLUMN IF EXISTS search_document;
+
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS data_search_document tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(data->>'title', '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(data->>'axisTitle', '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(data->>'text', '')), 'B')
+    ) STORED;
+
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS description_search_document tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('english', description), 'C')) STORED;
+
+ALTER TABLE favorites DROP COLUMN IF EXISTS search_document;
+
+ALTER TABLE favorites ADD COLUMN IF NOT EXISTS search_document tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('english', description), 'C')) STORED;
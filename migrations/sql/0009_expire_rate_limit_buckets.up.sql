@@ -0,0 +1,5 @@
+-- When each bucket is full again, from then on it is the same as no bucket and it can be deleted.
+-- The buckets that existed before are deleted by the first sweep.
+ALTER TABLE rate_limit_buckets ADD COLUMN IF NOT EXISTS full_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_full_at_idx ON rate_limit_buckets (full_at);
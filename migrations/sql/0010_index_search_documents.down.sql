@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS favorites_search_document_idx;
+DROP INDEX IF EXISTS assets_description_search_document_idx;
+DROP INDEX IF EXISTS assets_data_search_document_idx;
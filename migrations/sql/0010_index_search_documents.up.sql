@@ -0,0 +1,4 @@
+-- Serves the search, each document is matched on its own so that an index can find the candidates
+CREATE INDEX IF NOT EXISTS assets_data_search_document_idx ON assets USING GIN (data_search_document);
+CREATE INDEX IF NOT EXISTS assets_description_search_document_idx ON assets USING GIN (description_search_document);
+CREATE INDEX IF NOT EXISTS favorites_search_document_idx ON favorites USING GIN (search_document);
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// APIKey is a credential of a service calling the API.
+// Only a hash of its secret is kept, the secret itself is shown once when the key is created.
+type APIKey struct {
+	ID         string     `json:"id" db:"key_id"`
+	Name       string     `json:"name" db:"name"`
+	Scopes     []string   `json:"scopes" db:"-"`
+	SecretHash string     `json:"-" db:"secret_hash"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// Tells whether the key can still be used at the given time
+func (key APIKey) Active(at time.Time) bool {
+	return key.RevokedAt == nil && (key.ExpiresAt == nil || at.Before(*key.ExpiresAt))
+}
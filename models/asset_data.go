@@ -0,0 +1,259 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Maximum length of an asset id, matches the column size in the database
+const MaxAssetIDLength = 50
+
+// AssetData is the typed payload of an asset, there is one implementation per AssetType
+type AssetData interface {
+	// Returns the problems found in the payload, field names are relative to the payload
+	Validate() []FieldError
+}
+
+type ChartData struct {
+	Title     string    `json:"title"`
+	AxisTitle string    `json:"axisTitle"`
+	Data      []float64 `json:"data"`
+}
+
+type InsightData struct {
+	Text string `json:"text"`
+}
+
+// The numbers are pointers so that a missing one is told apart from a zero,
+// PurchasesLastMonth is a float so that 6.0 is accepted as a whole number
+type AudienceData struct {
+	Gender             string   `json:"gender"`
+	BirthCountry       string   `json:"birthCountry"`
+	AgeGroup           string   `json:"ageGroup"`
+	SocialMediaHours   *float64 `json:"socialMediaHours"`
+	PurchasesLastMonth *float64 `json:"purchasesLastMonth"`
+}
+
+// Registry of the payload of every asset type
+var AssetDataTypes = map[AssetType]func() AssetData{
+	ChartType:    func() AssetData { return &ChartData{} },
+	InsightType:  func() AssetData { return &InsightData{} },
+	AudienceType: func() AssetData { return &AudienceData{} },
+}
+
+// An age group is either a range like "24-35" or an open range like "65+"
+var ageGroupPattern = regexp.MustCompile(`^(\d+)(?:-(\d+)|\+)$`)
+
+func (d *ChartData) Validate() []FieldError {
+	var errs []FieldError
+	if strings.TrimSpace(d.Title) == "" {
+		errs = append(errs, FieldError{Field: "title", Message: "is required"})
+	}
+	if len(d.Data) == 0 {
+		errs = append(errs, FieldError{Field: "data", Message: "must contain at least one value"})
+	}
+	return errs
+}
+
+func (d *InsightData) Validate() []FieldError {
+	if strings.TrimSpace(d.Text) == "" {
+		return []FieldError{{Field: "text", Message: "is required"}}
+	}
+	return nil
+}
+
+func (d *AudienceData) Validate() []FieldError {
+	var errs []FieldError
+	if strings.TrimSpace(d.Gender) == "" {
+		errs = append(errs, FieldError{Field: "gender", Message: "is required"})
+	}
+	if strings.TrimSpace(d.BirthCountry) == "" {
+		errs = append(errs, FieldError{Field: "birthCountry", Message: "is required"})
+	}
+	if !isValidAgeGroup(d.AgeGroup) {
+		errs = append(errs, FieldError{Field: "ageGroup", Message: `must be a range like "24-35" or "65+"`})
+	}
+	switch {
+	case d.SocialMediaHours == nil:
+		errs = append(errs, FieldError{Field: "socialMediaHours", Message: "is required"})
+	case *d.SocialMediaHours < 0 || *d.SocialMediaHours > 24:
+		errs = append(errs, FieldError{Field: "socialMediaHours", Message: "must be between 0 and 24"})
+	}
+	switch {
+	case d.PurchasesLastMonth == nil:
+		errs = append(errs, FieldError{Field: "purchasesLastMonth", Message: "is required"})
+	case *d.PurchasesLastMonth != math.Trunc(*d.PurchasesLastMonth):
+		errs = append(errs, FieldError{Field: "purchasesLastMonth", Message: "must be a whole number"})
+	case *d.PurchasesLastMonth < 0:
+		errs = append(errs, FieldError{Field: "purchasesLastMonth", Message: "must not be negative"})
+	}
+	return errs
+}
+
+func isValidAgeGroup(ageGroup string) bool {
+	match := ageGroupPattern.FindStringSubmatch(ageGroup)
+	if match == nil {
+		return false
+	}
+	if match[2] == "" {
+		return true
+	}
+	low, _ := strconv.Atoi(match[1])
+	high, _ := strconv.Atoi(match[2])
+	return low <= high
+}
+
+// unknownFieldError is returned by DecodeData for a field the payload of the type does not have
+type unknownFieldError struct {
+	Field string
+}
+
+func (e *unknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %q", e.Field)
+}
+
+// Decodes the payload of the asset into the Go type registered for its type,
+// a field the type does not have is an *unknownFieldError
+func (asset Asset) DecodeData() (AssetData, error) {
+	newData, ok := AssetDataTypes[asset.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown asset type %q", asset.Type)
+	}
+	data := newData()
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(asset.Data, &fields); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	known := jsonFieldNames(data)
+	for _, name := range names {
+		if !known[name] {
+			return nil, &unknownFieldError{Field: name}
+		}
+	}
+
+	if err := json.Unmarshal(asset.Data, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Returns the names the fields of a payload have in JSON
+func jsonFieldNames(data AssetData) map[string]bool {
+	names := map[string]bool{}
+	dataType := reflect.TypeOf(data).Elem()
+	for i := 0; i < dataType.NumField(); i++ {
+		name, _, _ := strings.Cut(dataType.Field(i).Tag.Get("json"), ",")
+		names[name] = true
+	}
+	return names
+}
+
+// Validates the asset and its payload against the type it declares.
+// The returned error is a *ValidationError naming every bad field.
+func (asset Asset) Validate() error {
+	errs := assetIDErrors(asset.ID)
+
+	if _, ok := AssetDataTypes[asset.Type]; !ok {
+		errs = append(errs, FieldError{Field: "type", Message: "must be one of " + validAssetTypeNames()})
+		return newValidationError(errs)
+	}
+
+	if len(bytes.TrimSpace(asset.Data)) == 0 || bytes.Equal(bytes.TrimSpace(asset.Data), []byte("null")) {
+		errs = append(errs, FieldError{Field: "data", Message: "is required"})
+		return newValidationError(errs)
+	}
+
+	data, err := asset.DecodeData()
+	if err != nil {
+		errs = append(errs, decodeFieldError(err))
+		return newValidationError(errs)
+	}
+	for _, fieldErr := range data.Validate() {
+		errs = append(errs, FieldError{Field: "data." + fieldErr.Field, Message: fieldErr.Message})
+	}
+
+	return newValidationError(errs)
+}
+
+// Turns a json decoding error of the payload into a FieldError
+func decodeFieldError(err error) FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field == "" {
+			return FieldError{Field: "data", Message: "must be a JSON object"}
+		}
+		return FieldError{Field: "data." + typeErr.Field, Message: "must be of type " + typeErr.Type.String()}
+	}
+	var unknownErr *unknownFieldError
+	if errors.As(err, &unknownErr) {
+		return FieldError{Field: "data." + unknownErr.Field, Message: "is not allowed"}
+	}
+	return FieldError{Field: "data", Message: "is not valid JSON"}
+}
+
+func validAssetTypeNames() string {
+	names := make([]string, len(ValidAssetTypes))
+	for i, assetType := range ValidAssetTypes {
+		names[i] = string(assetType)
+	}
+	return strings.Join(names, ", ")
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validates the id of an asset given on its own, as when favorites are removed in bulk
+func ValidateAssetID(id string) error {
+	return newValidationError(assetIDErrors(id))
+}
+
+// Validates a new description, only the id of the asset has rules
+func (update DescriptionUpdate) Validate() error {
+	return newValidationError(assetIDErrors(update.ID))
+}
+
+func assetIDErrors(id string) []FieldError {
+	switch {
+	case strings.TrimSpace(id) == "":
+		return []FieldError{{Field: "id", Message: "is required"}}
+	case len(id) > MaxAssetIDLength:
+		return []FieldError{{Field: "id", Message: fmt.Sprintf("must be at most %d characters", MaxAssetIDLength)}}
+	}
+	return nil
+}
+
+// ValidationError lists every field of a payload that failed validation
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func newValidationError(errs []FieldError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: errs}
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, fieldErr := range e.Fields {
+		msgs[i] = fieldErr.Field + " " + fieldErr.Message
+	}
+	return "validation failed: " + strings.Join(msgs, ", ")
+}
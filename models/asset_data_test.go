@@ -0,0 +1,105 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssetValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		asset  Asset
+		fields []FieldError
+	}{
+		{
+			name:  "valid chart",
+			asset: Asset{ID: "chart1", Type: ChartType, Data: json.RawMessage(`{"title": "Test Chart", "axisTitle": "Test Axis", "data": [0, 1, 2]}`)},
+		},
+		{
+			name:  "valid insight",
+			asset: Asset{ID: "insight1", Type: InsightType, Data: json.RawMessage(`{"text": "40% of millennials spend more than 3 hours on social media daily."}`)},
+		},
+		{
+			name:  "valid audience with open age group",
+			asset: Asset{ID: "audience1", Type: AudienceType, Data: json.RawMessage(`{"gender": "Male", "birthCountry": "Greece", "ageGroup": "65+", "socialMediaHours": 0, "purchasesLastMonth": 0}`)},
+		},
+		{
+			name:  "audience with a whole number written as a float",
+			asset: Asset{ID: "audience1", Type: AudienceType, Data: json.RawMessage(`{"gender": "Male", "birthCountry": "Greece", "ageGroup": "24-35", "socialMediaHours": 3, "purchasesLastMonth": 6.0}`)},
+		},
+		{
+			name:   "missing id and data",
+			asset:  Asset{Type: InsightType},
+			fields: []FieldError{{Field: "id", Message: "is required"}, {Field: "data", Message: "is required"}},
+		},
+		{
+			name:   "id too long",
+			asset:  Asset{ID: "an-asset-id-that-is-way-longer-than-fifty-characters", Type: InsightType, Data: json.RawMessage(`{"text": "text"}`)},
+			fields: []FieldError{{Field: "id", Message: "must be at most 50 characters"}},
+		},
+		{
+			name:   "unknown type",
+			asset:  Asset{ID: "map1", Type: "Map", Data: json.RawMessage(`{}`)},
+			fields: []FieldError{{Field: "type", Message: "must be one of Chart, Insight, Audience"}},
+		},
+		{
+			name:   "data is not an object",
+			asset:  Asset{ID: "insight1", Type: InsightType, Data: json.RawMessage(`"text"`)},
+			fields: []FieldError{{Field: "data", Message: "must be a JSON object"}},
+		},
+		{
+			name:   "chart without title and series",
+			asset:  Asset{ID: "chart1", Type: ChartType, Data: json.RawMessage(`{"axisTitle": "Test Axis"}`)},
+			fields: []FieldError{{Field: "data.title", Message: "is required"}, {Field: "data.data", Message: "must contain at least one value"}},
+		},
+		{
+			name:   "audience with wrong field type",
+			asset:  Asset{ID: "audience1", Type: AudienceType, Data: json.RawMessage(`{"gender": "Male", "birthCountry": "Greece", "ageGroup": "24-35", "socialMediaHours": "3"}`)},
+			fields: []FieldError{{Field: "data.socialMediaHours", Message: "must be of type float64"}},
+		},
+		{
+			name:  "audience with invalid values",
+			asset: Asset{ID: "audience1", Type: AudienceType, Data: json.RawMessage(`{"gender": "", "birthCountry": "Greece", "ageGroup": "35-24", "socialMediaHours": 25, "purchasesLastMonth": -1}`)},
+			fields: []FieldError{
+				{Field: "data.gender", Message: "is required"},
+				{Field: "data.ageGroup", Message: `must be a range like "24-35" or "65+"`},
+				{Field: "data.socialMediaHours", Message: "must be between 0 and 24"},
+				{Field: "data.purchasesLastMonth", Message: "must not be negative"},
+			},
+		},
+		{
+			name:  "audience without its numbers",
+			asset: Asset{ID: "audience1", Type: AudienceType, Data: json.RawMessage(`{"gender": "Male", "birthCountry": "Greece", "ageGroup": "24-35"}`)},
+			fields: []FieldError{
+				{Field: "data.socialMediaHours", Message: "is required"},
+				{Field: "data.purchasesLastMonth", Message: "is required"},
+			},
+		},
+		{
+			name:   "audience with a fractional purchase count",
+			asset:  Asset{ID: "audience1", Type: AudienceType, Data: json.RawMessage(`{"gender": "Male", "birthCountry": "Greece", "ageGroup": "24-35", "socialMediaHours": 3, "purchasesLastMonth": 1.5}`)},
+			fields: []FieldError{{Field: "data.purchasesLastMonth", Message: "must be a whole number"}},
+		},
+		{
+			name:   "insight with unknown field",
+			asset:  Asset{ID: "insight1", Type: InsightType, Data: json.RawMessage(`{"text": "text", "title": "title"}`)},
+			fields: []FieldError{{Field: "data.title", Message: "is not allowed"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.asset.Validate()
+			if tt.fields == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				assert.Equal(t, tt.fields, validationErr.Fields)
+			}
+		})
+	}
+}
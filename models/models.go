@@ -1,6 +1,10 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+)
 
 type User struct {
 	ID     string `json:"id"`
@@ -17,6 +21,7 @@ const (
 
 var ValidAssetTypes = []AssetType{ChartType, InsightType, AudienceType}
 
+// Asset is an entry of the shared asset catalog
 type Asset struct {
 	ID          string          `json:"id" db:"asset_id"`
 	Type        AssetType       `json:"type" db:"type"`
@@ -24,7 +29,37 @@ type Asset struct {
 	Data        json.RawMessage `json:"data" db:"data"`
 }
 
+// Logs the asset as a group, the payload is under the data key so that it can be redacted
+func (a Asset) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", a.ID),
+		slog.String("type", string(a.Type)),
+		slog.String("description", a.Description),
+		slog.Any("data", a.Data),
+	)
+}
+
+// Favorite is an asset of the catalog as seen by the user who favorited it.
+// Description holds the user's own description when one has been set.
+type Favorite struct {
+	Asset
+	AddedAt time.Time `json:"added_at" db:"added_at"`
+
+	// Only set when favorites are searched, how well the favorite matches the search
+	// and an extract of its text with the matches highlighted
+	Rank    float32 `json:"rank,omitempty" db:"rank"`
+	Snippet string  `json:"snippet,omitempty" db:"snippet"`
+}
+
+// DescriptionUpdate is the new description a user gives to one of their favorites
+type DescriptionUpdate struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+}
+
+// AssetError is the failure of one asset of a batch, Index is its position in the batch
 type AssetError struct {
+	Index int
 	Asset Asset
 	Err   error
 }
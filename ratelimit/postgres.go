@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresBackend keeps the buckets in postgres, so that every replica enforces the same limit.
+// The database clock is used, so the clocks of the replicas don't need to agree.
+// A full bucket is the same as no bucket, so the full ones are deleted once per sweep interval.
+type PostgresBackend struct {
+	db *sqlx.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresBackend(db *sqlx.DB) *PostgresBackend {
+	return &PostgresBackend{db: db}
+}
+
+// Refills and takes from the bucket in one statement, the row lock orders concurrent requests.
+// $2 is the burst and $3 the rate, the SET expressions all see the bucket before the request.
+const takeQuery = `
+    INSERT INTO rate_limit_buckets AS b (bucket_key, tokens, allowed, updated_at, full_at)
+    VALUES ($1, $2::double precision - 1, true, now(), now() + interval '1 second' / $3::double precision)
+    ON CONFLICT (bucket_key) DO UPDATE SET
+        tokens = ` + takenTokens + `,
+        allowed = ` + refilledTokens + ` >= 1,
+        updated_at = now(),
+        full_at = now() + interval '1 second' * ($2::double precision - ` + takenTokens + `) / $3::double precision
+    RETURNING tokens, allowed`
+
+// Tokens of the bucket after refilling it for the time since the last request
+const refilledTokens = "LEAST($2::double precision, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::double precision)"
+
+// Tokens of the bucket after taking one out of it, if there is one
+const takenTokens = "CASE WHEN " + refilledTokens + " >= 1 THEN " + refilledTokens + " - 1 ELSE " + refilledTokens + " END"
+
+// A bucket taken from while it is deleted is locked by the take, the delete then sees it is not full any more
+const sweepQuery = `DELETE FROM rate_limit_buckets WHERE full_at <= now()`
+
+func (p *PostgresBackend) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := p.sweep(ctx); err != nil {
+		return Result{}, err
+	}
+
+	var row struct {
+		Tokens  float64 `db:"tokens"`
+		Allowed bool    `db:"allowed"`
+	}
+	if err := p.db.GetContext(ctx, &row, takeQuery, key, float64(limit.Burst), limit.Rate); err != nil {
+		return Result{}, err
+	}
+	return newResult(row.Tokens, row.Allowed, limit), nil
+}
+
+// Deletes the full buckets, at most once per interval so that it costs little per request.
+// Every replica sweeps, a sweep finding nothing to delete is cheap with the index on full_at.
+func (p *PostgresBackend) sweep(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	due := now.Sub(p.lastSweep) >= sweepInterval
+	if due {
+		p.lastSweep = now
+	}
+	p.mu.Unlock()
+	if !due {
+		return nil
+	}
+
+	if _, err := p.db.ExecContext(ctx, sweepQuery); err != nil {
+		return fmt.Errorf("deleting the full rate limit buckets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Package ratelimit limits how often each client may call each route with token buckets
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: it holds up to Burst requests and refills at Rate requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Length of the window the limit is expressed over, for the RateLimit-Policy header
+func (l Limit) Window() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+var units = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// Parses a limit written <requests>/<s|m|h>[:burst], for example "120/m" or "10/s:50".
+// The burst defaults to the number of requests.
+func ParseLimit(value string) (Limit, error) {
+	spec, burstStr, hasBurst := strings.Cut(strings.TrimSpace(value), ":")
+	countStr, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<s|m|h>[:burst]", value)
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 1 {
+		return Limit{}, fmt.Errorf("invalid number of requests in rate limit %q", value)
+	}
+	per, ok := units[unit]
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid unit in rate limit %q, expected s, m or h", value)
+	}
+
+	limit := Limit{Rate: float64(count) / per.Seconds(), Burst: count}
+	if hasBurst {
+		limit.Burst, err = strconv.Atoi(burstStr)
+		if err != nil || limit.Burst < 1 {
+			return Limit{}, fmt.Errorf("invalid burst in rate limit %q", value)
+		}
+	}
+	return limit, nil
+}
+
+// Rules are the limits of the routes, the routes are named "<METHOD> <path template>"
+type Rules struct {
+	// Limit of the routes without their own, no limit when nil
+	Default *Limit
+	Routes  map[string]Limit
+	// Limit of each IP across the routes, checked before the request is authenticated, no limit when nil
+	IP *Limit
+}
+
+// Parses the per route limits, written "<METHOD> <path template>=<limit>" and separated by ";".
+// For example "POST /multiple/favorites/{user_id}=10/m;GET /favorites/{user_id}=300/m".
+func ParseRoutes(value string) (map[string]Limit, error) {
+	routes := make(map[string]Limit)
+	for _, rule := range strings.Split(value, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		route, limitStr, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route rate limit %q, expected <METHOD> <path>=<limit>", rule)
+		}
+		limit, err := ParseLimit(limitStr)
+		if err != nil {
+			return nil, err
+		}
+		routes[strings.Join(strings.Fields(route), " ")] = limit
+	}
+	return routes, nil
+}
+
+// Returns the limit of a route, false when the route is not limited
+func (r Rules) limit(route string) (Limit, bool) {
+	if limit, ok := r.Routes[route]; ok {
+		return limit, true
+	}
+	if r.Default != nil {
+		return *r.Default, true
+	}
+	return Limit{}, false
+}
+
+// Result is the state of a bucket after taking a token out of it
+type Result struct {
+	Allowed bool
+	// Whole tokens left in the bucket
+	Remaining int
+	// Time until a token is available, zero when the request was allowed
+	RetryAfter time.Duration
+	// Time until the bucket is full again
+	Reset time.Duration
+}
+
+// Backend keeps the buckets. A shared backend lets several replicas enforce one limit.
+type Backend interface {
+	// Takes a token out of the bucket of the key, if there is one
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Limiter applies the rules of the routes with the buckets of a backend
+type Limiter struct {
+	backend Backend
+	rules   Rules
+}
+
+func NewLimiter(backend Backend, rules Rules) *Limiter {
+	return &Limiter{backend: backend, rules: rules}
+}
+
+// Takes a token for a request of the client to the route.
+// It returns false when the route is not limited.
+func (l *Limiter) Take(ctx context.Context, route, client string) (Result, Limit, bool, error) {
+	limit, ok := l.rules.limit(route)
+	if !ok {
+		return Result{}, Limit{}, false, nil
+	}
+	result, err := l.backend.Take(ctx, route+" "+client, limit)
+	return result, limit, true, err
+}
+
+// Takes a token for a request from the IP, whatever its route.
+// It returns false when the IPs are not limited.
+func (l *Limiter) TakeIP(ctx context.Context, ip string) (Result, Limit, bool, error) {
+	if l.rules.IP == nil {
+		return Result{}, Limit{}, false, nil
+	}
+	result, err := l.backend.Take(ctx, "ip "+ip, *l.rules.IP)
+	return result, *l.rules.IP, true, err
+}
+
+// Computes the result of a bucket that holds tokens after the refill
+func newResult(tokens float64, allowed bool, limit Limit) Result {
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(0, s) * float64(time.Second))
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := map[string]Limit{
+		"120/m":   {Rate: 2, Burst: 120},
+		"10/s:50": {Rate: 10, Burst: 50},
+		" 36/h ":  {Rate: 0.01, Burst: 36},
+	}
+	for value, expected := range tests {
+		limit, err := ParseLimit(value)
+		require.NoError(t, err, value)
+		assert.InDelta(t, expected.Rate, limit.Rate, 1e-9, value)
+		assert.Equal(t, expected.Burst, limit.Burst, value)
+	}
+
+	for _, value := range []string{"", "120", "0/m", "-1/m", "10/d", "ten/m", "10/m:0", "10/m:x"} {
+		_, err := ParseLimit(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("POST  /multiple/favorites/{user_id}=10/m; GET /favorites/{user_id}=5/s;")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Limit{
+		"POST /multiple/favorites/{user_id}": {Rate: 10.0 / 60, Burst: 10},
+		"GET /favorites/{user_id}":           {Rate: 5, Burst: 5},
+	}, routes)
+
+	_, err = ParseRoutes("GET /favorites/{user_id}")
+	assert.Error(t, err)
+}
+
+func TestMemoryBackend(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	backend := NewMemoryBackend()
+	backend.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 3}
+	ctx := context.Background()
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := backend.Take(ctx, "client", limit)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	result, err := backend.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// Other clients have their own bucket
+	result, err = backend.Take(ctx, "other client", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// The bucket refills at the rate but never above the burst
+	now = now.Add(1500 * time.Millisecond)
+	result, err = backend.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	now = now.Add(time.Hour)
+	result, err = backend.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Remaining)
+
+	// Full buckets are dropped
+	now = now.Add(time.Hour)
+	_, err = backend.Take(ctx, "client", limit)
+	require.NoError(t, err)
+	assert.Len(t, backend.buckets, 1)
+}
+
+func TestLimiter(t *testing.T) {
+	defaultLimit := Limit{Rate: 1, Burst: 2}
+	limiter := NewLimiter(NewMemoryBackend(), Rules{
+		Default: &defaultLimit,
+		Routes:  map[string]Limit{"POST /bulk": {Rate: 1, Burst: 1}},
+	})
+	ctx := context.Background()
+
+	result, limit, limited, err := limiter.Take(ctx, "POST /bulk", "client")
+	require.NoError(t, err)
+	assert.True(t, limited)
+	assert.Equal(t, 1, limit.Burst)
+	assert.True(t, result.Allowed)
+
+	result, _, _, err = limiter.Take(ctx, "POST /bulk", "client")
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	// Each route has its own bucket
+	result, limit, _, err = limiter.Take(ctx, "GET /favorites", "client")
+	require.NoError(t, err)
+	assert.Equal(t, defaultLimit, limit)
+	assert.True(t, result.Allowed)
+
+	_, _, limited, err = NewLimiter(NewMemoryBackend(), Rules{}).Take(ctx, "GET /favorites", "client")
+	require.NoError(t, err)
+	assert.False(t, limited)
+	_, _, limited, err = limiter.TakeIP(ctx, "192.0.2.1")
+	require.NoError(t, err)
+	assert.False(t, limited)
+
+	// The bucket of an IP is shared by the routes and apart from the ones of the routes
+	ipLimiter := NewLimiter(NewMemoryBackend(), Rules{Default: &defaultLimit, IP: &Limit{Rate: 1, Burst: 1}})
+	result, limit, limited, err = ipLimiter.TakeIP(ctx, "192.0.2.1")
+	require.NoError(t, err)
+	assert.True(t, limited)
+	assert.Equal(t, 1, limit.Burst)
+	assert.True(t, result.Allowed)
+	result, _, _, err = ipLimiter.TakeIP(ctx, "192.0.2.1")
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	result, _, _, err = ipLimiter.Take(ctx, "GET /favorites", "ip:192.0.2.1")
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/config"
+)
+
+// Builds the HTTP server with the timeouts of the config
+func newServer(cfg *config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.HTTPAddr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// Serves on the listener until ctx is done. It then calls onShutdown, keeps serving for the shutdown delay
+// and drains the requests in flight within the grace period. It returns nil once every request is drained.
+func serve(ctx context.Context, cfg *config.Config, server *http.Server, listener net.Listener, onShutdown func()) error {
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return errors.New("both a TLS certificate and a key are needed to serve HTTPS")
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if cfg.TLSCertFile != "" {
+			errCh <- server.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			errCh <- server.Serve(listener)
+		}
+	}()
+	slog.Info("listening", slog.String("addr", listener.Addr().String()), slog.Bool("tls", cfg.TLSCertFile != ""))
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", slog.Duration("delay", cfg.ShutdownDelay), slog.Duration("grace_period", cfg.ShutdownGracePeriod))
+	onShutdown()
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownGracePeriod)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// Cut the connections of the requests that did not make it
+		server.Close()
+		return fmt.Errorf("failed to drain the requests in flight: %w", err)
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
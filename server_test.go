@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Serves a handler that blocks until release is closed, and returns the URL and the result of serve
+func startServer(t *testing.T, ctx context.Context, cfg *config.Config, release chan struct{}, onShutdown func()) (string, chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, cfg, newServer(cfg, handler), listener, onShutdown)
+	}()
+	return "http://" + listener.Addr().String(), done
+}
+
+func TestServe_DrainsRequestsInFlight(t *testing.T) {
+	cfg := &config.Config{ShutdownGracePeriod: 5 * time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	shutdownStarted := make(chan struct{})
+	url, done := startServer(t, ctx, cfg, release, func() { close(shutdownStarted) })
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		response, err := http.Get(url)
+		assert.NoError(t, err)
+		responses <- response
+	}()
+	// Lets the request reach the handler before the shutdown starts
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-shutdownStarted
+
+	// The request in flight still completes, new connections are refused
+	close(release)
+	response := <-responses
+	require.NotNil(t, response)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response.Body.Close()
+
+	assert.NoError(t, <-done)
+	_, err := http.Get(url)
+	assert.Error(t, err)
+}
+
+func TestServe_GracePeriodExceeded(t *testing.T) {
+	cfg := &config.Config{ShutdownGracePeriod: 100 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	url, done := startServer(t, ctx, cfg, release, func() {})
+
+	go http.Get(url)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	assert.ErrorContains(t, <-done, "failed to drain the requests in flight")
+}
+
+func TestServe_TLSNeedsCertificateAndKey(t *testing.T) {
+	cfg := &config.Config{TLSCertFile: "cert.pem"}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	err = serve(context.Background(), cfg, newServer(cfg, http.NotFoundHandler()), listener, func() {})
+	assert.Error(t, err)
+}
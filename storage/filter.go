@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arhsxro/platform-go-challenge/models"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Parses the values of the type query parameter, each one a single type or a comma separated list of types
+func ParseTypes(values []string) ([]models.AssetType, error) {
+	var types []models.AssetType
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			assetType := models.AssetType(strings.TrimSpace(part))
+			if assetType == "" || slices.Contains(types, assetType) {
+				continue
+			}
+			types = append(types, assetType)
+		}
+	}
+	if err := validateTypes(types); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+// Checks every type against models.ValidAssetTypes
+func validateTypes(types []models.AssetType) error {
+	for _, assetType := range types {
+		if !slices.Contains(models.ValidAssetTypes, assetType) {
+			return fmt.Errorf("%w %q, expected one of Chart, Insight, Audience", ErrInvalidAssetType, assetType)
+		}
+	}
+	return nil
+}
+
+// AudienceField is an attribute of the data of audience assets favorites can be filtered by
+type AudienceField string
+
+const (
+	AudienceGender             AudienceField = "gender"
+	AudienceBirthCountry       AudienceField = "birthCountry"
+	AudienceAgeGroup           AudienceField = "ageGroup"
+	AudienceSocialMediaHours   AudienceField = "socialMediaHours"
+	AudiencePurchasesLastMonth AudienceField = "purchasesLastMonth"
+)
+
+// The fields that can be filtered by and whether their values are numbers
+var audienceFields = map[AudienceField]bool{
+	AudienceGender:             false,
+	AudienceBirthCountry:       false,
+	AudienceAgeGroup:           false,
+	AudienceSocialMediaHours:   true,
+	AudiencePurchasesLastMonth: true,
+}
+
+// FilterOperator compares an audience field with the value of a filter
+type FilterOperator string
+
+const (
+	OpEq  FilterOperator = "eq"
+	OpNe  FilterOperator = "ne"
+	OpGt  FilterOperator = "gt"
+	OpGte FilterOperator = "gte"
+	OpLt  FilterOperator = "lt"
+	OpLte FilterOperator = "lte"
+)
+
+// The operators that can be used and the jsonpath comparison of each
+var filterOperators = map[FilterOperator]string{
+	OpEq:  "==",
+	OpNe:  "!=",
+	OpGt:  ">",
+	OpGte: ">=",
+	OpLt:  "<",
+	OpLte: "<=",
+}
+
+// AudienceFilter keeps the favorites whose audience data field compares to Value with Operator.
+// Value is a float64 for the numeric fields and a string otherwise.
+type AudienceFilter struct {
+	Field    AudienceField
+	Operator FilterOperator
+	Value    any
+}
+
+// Query parameters of the audience filters, audience.<field> or audience.<field>[<operator>]
+var audienceParamPattern = regexp.MustCompile(`^audience\.(\w+)(?:\[(\w+)\])?$`)
+
+// Parses the audience filters of the query parameters, for example
+// audience.gender=Female&audience.socialMediaHours[gte]=3.
+// Parameters that do not start with "audience." are ignored.
+func ParseAudienceFilters(params url.Values) ([]AudienceFilter, error) {
+	// Sorted so that the filters, and the queries built out of them, do not depend on map order
+	var names []string
+	for name := range params {
+		if strings.HasPrefix(name, "audience.") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var filters []AudienceFilter
+	for _, name := range names {
+		match := audienceParamPattern.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("%w: malformed parameter %q, expected audience.<field> or audience.<field>[<operator>]", ErrInvalidFilter, name)
+		}
+		filter := AudienceFilter{Field: AudienceField(match[1]), Operator: OpEq}
+		if match[2] != "" {
+			filter.Operator = FilterOperator(match[2])
+		}
+
+		numeric, ok := audienceFields[filter.Field]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown audience field %q, expected one of gender, birthCountry, ageGroup, socialMediaHours, purchasesLastMonth", ErrInvalidFilter, match[1])
+		}
+		if _, ok := filterOperators[filter.Operator]; !ok {
+			return nil, fmt.Errorf("%w: unknown operator %q, expected one of eq, ne, gt, gte, lt, lte", ErrInvalidFilter, match[2])
+		}
+		if !numeric && filter.Operator != OpEq && filter.Operator != OpNe {
+			return nil, fmt.Errorf("%w: %s can only be compared with eq and ne", ErrInvalidFilter, filter.Field)
+		}
+
+		for _, value := range params[name] {
+			filter := filter
+			filter.Value = value
+			if numeric {
+				number, err := strconv.ParseFloat(value, 64)
+				if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+					return nil, fmt.Errorf("%w: %s must be a number, got %q", ErrInvalidFilter, filter.Field, value)
+				}
+				filter.Value = number
+			}
+			filters = append(filters, filter)
+		}
+	}
+	return filters, nil
+}
+
+// Groups the values of the equality filters by field, a field equal to any of them passes
+func equalValues(filters []AudienceFilter) map[AudienceField][]any {
+	values := map[AudienceField][]any{}
+	for _, filter := range filters {
+		if filter.Operator == OpEq {
+			values[filter.Field] = append(values[filter.Field], filter.Value)
+		}
+	}
+	return values
+}
+
+// Tells whether the data of a favorite passes every filter, a missing field never passes.
+// The equality filters of a field pass when one of them does.
+func matchesAudience(favorite models.Favorite, filters []AudienceFilter) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	if favorite.Type != models.AudienceType {
+		return false
+	}
+	var data map[string]any
+	if err := json.Unmarshal(favorite.Data, &data); err != nil {
+		return false
+	}
+
+	for field, values := range equalValues(filters) {
+		if !slices.ContainsFunc(values, func(value any) bool {
+			return passesAudience(data, AudienceFilter{Field: field, Operator: OpEq, Value: value})
+		}) {
+			return false
+		}
+	}
+	for _, filter := range filters {
+		if filter.Operator != OpEq && !passesAudience(data, filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func passesAudience(data map[string]any, filter AudienceFilter) bool {
+	var result int
+	switch value := data[string(filter.Field)].(type) {
+	case string:
+		expected, ok := filter.Value.(string)
+		if !ok {
+			return false
+		}
+		result = strings.Compare(value, expected)
+	case float64:
+		expected, ok := filter.Value.(float64)
+		if !ok {
+			return false
+		}
+		result = cmp.Compare(value, expected)
+	default:
+		return false
+	}
+
+	switch filter.Operator {
+	case OpEq:
+		return result == 0
+	case OpNe:
+		return result != 0
+	case OpGt:
+		return result > 0
+	case OpGte:
+		return result >= 0
+	case OpLt:
+		return result < 0
+	case OpLte:
+		return result <= 0
+	}
+	return false
+}
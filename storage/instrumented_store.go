@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/metrics"
+	"github.com/arhsxro/platform-go-challenge/models"
+)
+
+// InstrumentedStore measures the latency of every operation of the store it wraps and counts the failed ones
+type InstrumentedStore struct {
+	store Store
+}
+
+func NewInstrumentedStore(store Store) *InstrumentedStore {
+	return &InstrumentedStore{store: store}
+}
+
+func (s *InstrumentedStore) GetUserFavorites(ctx context.Context, userID string, opts ListOptions) (FavoritesPage, error) {
+	start := time.Now()
+	page, err := s.store.GetUserFavorites(ctx, userID, opts)
+	metrics.ObserveStorage("GetUserFavorites", time.Since(start), err)
+	return page, err
+}
+
+func (s *InstrumentedStore) CountUserFavorites(ctx context.Context, userID string, opts ListOptions) (int, error) {
+	start := time.Now()
+	count, err := s.store.CountUserFavorites(ctx, userID, opts)
+	metrics.ObserveStorage("CountUserFavorites", time.Since(start), err)
+	return count, err
+}
+
+func (s *InstrumentedStore) AddFavorite(ctx context.Context, userID string, asset models.Asset) error {
+	start := time.Now()
+	err := s.store.AddFavorite(ctx, userID, asset)
+	metrics.ObserveStorage("AddFavorite", time.Since(start), err)
+	return err
+}
+
+func (s *InstrumentedStore) AddFavorites(ctx context.Context, userID string, assets []models.Asset) ([]string, error) {
+	start := time.Now()
+	added, err := s.store.AddFavorites(ctx, userID, assets)
+	metrics.ObserveStorage("AddFavorites", time.Since(start), err)
+	return added, err
+}
+
+func (s *InstrumentedStore) RemoveFavorite(ctx context.Context, userID, assetID string) error {
+	start := time.Now()
+	err := s.store.RemoveFavorite(ctx, userID, assetID)
+	metrics.ObserveStorage("RemoveFavorite", time.Since(start), err)
+	return err
+}
+
+func (s *InstrumentedStore) UpdateDescription(ctx context.Context, userID, assetID, newDescription string) error {
+	start := time.Now()
+	err := s.store.UpdateDescription(ctx, userID, assetID, newDescription)
+	metrics.ObserveStorage("UpdateDescription", time.Since(start), err)
+	return err
+}
+
+func (s *InstrumentedStore) RemoveFavorites(ctx context.Context, userID string, assetIDs []string) ([]string, error) {
+	start := time.Now()
+	removed, err := s.store.RemoveFavorites(ctx, userID, assetIDs)
+	metrics.ObserveStorage("RemoveFavorites", time.Since(start), err)
+	return removed, err
+}
+
+func (s *InstrumentedStore) UpdateDescriptions(ctx context.Context, userID string, updates []models.DescriptionUpdate) ([]string, error) {
+	start := time.Now()
+	updated, err := s.store.UpdateDescriptions(ctx, userID, updates)
+	metrics.ObserveStorage("UpdateDescriptions", time.Since(start), err)
+	return updated, err
+}
+
+// Not measured, the probes would drown the latencies of the requests
+func (s *InstrumentedStore) Ping(ctx context.Context) error {
+	return s.store.Ping(ctx)
+}
+
+func (s *InstrumentedStore) Close() error {
+	return s.store.Close()
+}
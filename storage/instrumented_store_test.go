@@ -0,0 +1,15 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/arhsxro/platform-go-challenge/storage"
+	"github.com/arhsxro/platform-go-challenge/storage/storagetest"
+)
+
+// The decorator must not change what the store it wraps does
+func TestInstrumentedStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.NewInstrumentedStore(storage.NewMemoryStore())
+	})
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/models"
+)
+
+func (store *MemoryStore) CreateAPIKey(ctx context.Context, key models.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.apiKeys[key.ID]; ok {
+		return fmt.Errorf("api key %s already exists", key.ID)
+	}
+	key.CreatedAt = key.CreatedAt.Truncate(time.Microsecond)
+	store.apiKeys[key.ID] = copyAPIKey(key)
+	return nil
+}
+
+func (store *MemoryStore) GetAPIKey(ctx context.Context, id string) (models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	key, ok := store.apiKeys[id]
+	if !ok {
+		return models.APIKey{}, ErrNotFound
+	}
+	return copyAPIKey(key), nil
+}
+
+// Lists every key, the most recently created first
+func (store *MemoryStore) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(store.apiKeys))
+	for _, key := range store.apiKeys {
+		keys = append(keys, copyAPIKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.After(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (store *MemoryStore) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	key, ok := store.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		key.RevokedAt = &now
+		store.apiKeys[id] = key
+	}
+	return nil
+}
+
+func (store *MemoryStore) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	key, ok := store.apiKeys[id]
+	if !ok {
+		return nil
+	}
+	if key.LastUsedAt == nil || key.LastUsedAt.Before(usedAt.Add(-apiKeyTouchInterval)) {
+		usedAt = usedAt.Truncate(time.Microsecond)
+		key.LastUsedAt = &usedAt
+		store.apiKeys[id] = key
+	}
+	return nil
+}
+
+// Copies a key so that callers and the store share no memory
+func copyAPIKey(key models.APIKey) models.APIKey {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	key.ExpiresAt = copyTime(key.ExpiresAt)
+	key.LastUsedAt = copyTime(key.LastUsedAt)
+	key.RevokedAt = copyTime(key.RevokedAt)
+	return key
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"encoding/json"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/arhsxro/platform-go-challenge/models"
+)
+
+// Number of words of a snippet, like the MaxWords of the postgres headline
+const snippetWords = 20
+
+// substringSearch is the search of the stores without full-text search.
+// Every term of the query must appear in the description or in the text content of a favorite, like the
+// documents of postgres, terms starting with "-" must not appear in either, "or" is ignored and quoted phrases
+// are matched word by word.
+type substringSearch struct {
+	included []*regexp.Regexp
+	excluded []*regexp.Regexp
+	// Matches any included term, to highlight the snippet
+	highlight *regexp.Regexp
+}
+
+func newSubstringSearch(query string) *substringSearch {
+	search := &substringSearch{}
+	var quoted []string
+	for _, term := range strings.Fields(query) {
+		term = strings.Trim(term, `"`)
+		if term == "" || strings.EqualFold(term, "or") {
+			continue
+		}
+		if excluded, ok := strings.CutPrefix(term, "-"); ok {
+			if excluded != "" {
+				search.excluded = append(search.excluded, regexp.MustCompile("(?i)"+regexp.QuoteMeta(excluded)))
+			}
+			continue
+		}
+		search.included = append(search.included, regexp.MustCompile("(?i)"+regexp.QuoteMeta(term)))
+		quoted = append(quoted, regexp.QuoteMeta(term))
+	}
+	if len(quoted) > 0 {
+		search.highlight = regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	}
+	return search
+}
+
+// Tells whether the favorite matches the search and sets its rank and snippet
+func (search *substringSearch) match(favorite *models.Favorite) bool {
+	if search.highlight == nil {
+		return false
+	}
+	texts := searchableTexts(*favorite)
+	document := strings.Join(texts, " ")
+
+	for _, excluded := range search.excluded {
+		if excluded.MatchString(document) {
+			return false
+		}
+	}
+	description, data := texts[0], strings.Join(texts[1:], " ")
+	if !search.matchesAll(description) && !search.matchesAll(data) {
+		return false
+	}
+
+	// The rank is the share of the words of the document that match
+	matches := len(search.highlight.FindAllStringIndex(document, -1))
+	favorite.Rank = float32(matches) / float32(len(strings.Fields(document))+1)
+
+	for _, text := range texts {
+		if search.highlight.MatchString(text) {
+			favorite.Snippet = search.snippet(text)
+			break
+		}
+	}
+	return true
+}
+
+func (search *substringSearch) matchesAll(text string) bool {
+	for _, included := range search.included {
+		if !included.MatchString(text) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the words of the text around the first match, HTML escaped and with every match highlighted
+func (search *substringSearch) snippet(text string) string {
+	words := strings.Fields(text)
+	first := 0
+	for i, word := range words {
+		if search.highlight.MatchString(word) {
+			first = i
+			break
+		}
+	}
+	start := max(0, min(first-snippetWords/4, len(words)-snippetWords))
+	end := min(len(words), start+snippetWords)
+	excerpt := strings.Join(words[start:end], " ")
+
+	var snippet strings.Builder
+	last := 0
+	for _, match := range search.highlight.FindAllStringIndex(excerpt, -1) {
+		snippet.WriteString(html.EscapeString(excerpt[last:match[0]]))
+		snippet.WriteString("<b>" + html.EscapeString(excerpt[match[0]:match[1]]) + "</b>")
+		last = match[1]
+	}
+	snippet.WriteString(html.EscapeString(excerpt[last:]))
+	return snippet.String()
+}
+
+// Returns the description of a favorite and the text fields of its data
+func searchableTexts(favorite models.Favorite) []string {
+	texts := []string{favorite.Description}
+	var data map[string]any
+	if err := json.Unmarshal(favorite.Data, &data); err != nil {
+		return texts
+	}
+	for _, field := range []string{"title", "axisTitle", "text"} {
+		if text, ok := data[field].(string); ok && text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/models"
+)
+
+// MemoryStore keeps the asset catalog and the favorites in memory.
+// It behaves like PostgresStore and is meant for local development and tests.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	assets    map[string]models.Asset
+	favorites map[string]map[string]*memoryFavorite // user id -> asset id -> favorite
+	apiKeys   map[string]models.APIKey
+}
+
+type memoryFavorite struct {
+	assetID string
+	// nil when the catalog description is used
+	description *string
+	addedAt     time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		assets:    make(map[string]models.Asset),
+		favorites: make(map[string]map[string]*memoryFavorite),
+		apiKeys:   make(map[string]models.APIKey),
+	}
+}
+
+// Retrieves a page of a user's favorite assets
+func (store *MemoryStore) GetUserFavorites(ctx context.Context, userID string, opts ListOptions) (FavoritesPage, error) {
+	if err := validateTypes(opts.Types); err != nil {
+		logging.FromContext(ctx).Info("invalid asset type", slog.Any("error", err))
+		return FavoritesPage{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return FavoritesPage{}, err
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	order := opts.Order()
+	var favorites []models.Favorite
+	for _, favorite := range store.matchingFavorites(userID, opts) {
+		if opts.After != nil && compareFavorites(favorite, opts.After.favorite(), order) <= 0 {
+			continue
+		}
+		favorites = append(favorites, favorite)
+	}
+	sort.Slice(favorites, func(i, j int) bool {
+		return compareFavorites(favorites[i], favorites[j], order) < 0
+	})
+
+	offset := 0
+	if opts.After == nil {
+		offset = (opts.Page - 1) * opts.PageSize
+	}
+	if offset >= len(favorites) {
+		return FavoritesPage{}, nil
+	}
+	// One more favorite than the page size tells whether there is a next page
+	end := offset + opts.PageSize + 1
+	if end > len(favorites) {
+		end = len(favorites)
+	}
+	return newFavoritesPage(favorites[offset:end], opts), nil
+}
+
+// Counts the favorites of a user that match the filters of opts, pagination is ignored
+func (store *MemoryStore) CountUserFavorites(ctx context.Context, userID string, opts ListOptions) (int, error) {
+	if err := validateTypes(opts.Types); err != nil {
+		logging.FromContext(ctx).Info("invalid asset type", slog.Any("error", err))
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return len(store.matchingFavorites(userID, opts)), nil
+}
+
+// Returns the favorites of a user that match the filters of opts, in no particular order.
+// The caller must hold the lock.
+func (store *MemoryStore) matchingFavorites(userID string, opts ListOptions) []models.Favorite {
+	var search *substringSearch
+	if opts.Search != "" {
+		search = newSubstringSearch(opts.Search)
+	}
+
+	var favorites []models.Favorite
+	for _, favorite := range store.favorites[userID] {
+		if len(opts.Types) > 0 && !slices.Contains(opts.Types, store.assets[favorite.assetID].Type) {
+			continue
+		}
+		model := store.toModel(favorite)
+		if !matchesAudience(model, opts.Audience) {
+			continue
+		}
+		if search != nil && !search.match(&model) {
+			continue
+		}
+		favorites = append(favorites, model)
+	}
+	return favorites
+}
+
+// Adds an asset to the favorites of a user.
+// The asset is added to the catalog first if it is not already there.
+func (store *MemoryStore) AddFavorite(ctx context.Context, userID string, asset models.Asset) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkData(asset); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if !store.addFavorite(userID, asset) {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// Adds a batch of assets to the favorites of a user at once
+func (store *MemoryStore) AddFavorites(ctx context.Context, userID string, assets []models.Asset) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkData(assets...); err != nil {
+		return nil, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	added := []string{}
+	for _, asset := range assets {
+		if store.addFavorite(userID, asset) {
+			added = append(added, asset.ID)
+		}
+	}
+	return added, nil
+}
+
+// Refuses the assets whose data is not JSON like the jsonb column of postgres does, before any of them is added
+func checkData(assets ...models.Asset) error {
+	for _, asset := range assets {
+		if !json.Valid(asset.Data) {
+			return fmt.Errorf("the data of asset %s is not valid JSON", asset.ID)
+		}
+	}
+	return nil
+}
+
+// Adds an asset to the catalog and to the favorites of a user unless they already have it,
+// it returns false when they do. The caller must hold the lock.
+func (store *MemoryStore) addFavorite(userID string, asset models.Asset) bool {
+	catalogAsset, ok := store.assets[asset.ID]
+	if !ok {
+		catalogAsset = asset
+		catalogAsset.Data = append([]byte(nil), asset.Data...)
+		store.assets[asset.ID] = catalogAsset
+	}
+
+	userFavorites, ok := store.favorites[userID]
+	if !ok {
+		userFavorites = make(map[string]*memoryFavorite)
+		store.favorites[userID] = userFavorites
+	}
+	if _, ok := userFavorites[asset.ID]; ok {
+		return false
+	}
+
+	favorite := &memoryFavorite{
+		assetID: asset.ID,
+		// Postgres keeps timestamps with microsecond precision
+		addedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if asset.Description != catalogAsset.Description {
+		description := asset.Description
+		favorite.description = &description
+	}
+	userFavorites[asset.ID] = favorite
+	return true
+}
+
+// Removes an asset from the favorites of a user, the asset stays in the catalog
+func (store *MemoryStore) RemoveFavorite(ctx context.Context, userID, assetID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.favorites[userID][assetID]; !ok {
+		return ErrNotFound
+	}
+	delete(store.favorites[userID], assetID)
+	return nil
+}
+
+// Updates the description a user has for one of their favorite assets
+func (store *MemoryStore) UpdateDescription(ctx context.Context, userID, assetID, newDescription string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	favorite, ok := store.favorites[userID][assetID]
+	if !ok {
+		return ErrNotFound
+	}
+	favorite.description = &newDescription
+	return nil
+}
+
+// Removes a batch of favorites of a user, the assets stay in the catalog
+func (store *MemoryStore) RemoveFavorites(ctx context.Context, userID string, assetIDs []string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	removed := []string{}
+	for _, assetID := range assetIDs {
+		if _, ok := store.favorites[userID][assetID]; ok {
+			delete(store.favorites[userID], assetID)
+			removed = append(removed, assetID)
+		}
+	}
+	return removed, nil
+}
+
+// Updates the descriptions of a batch of favorites of a user
+func (store *MemoryStore) UpdateDescriptions(ctx context.Context, userID string, updates []models.DescriptionUpdate) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	updated := []string{}
+	for _, update := range updates {
+		if favorite, ok := store.favorites[userID][update.ID]; ok {
+			description := update.Description
+			favorite.description = &description
+			if !slices.Contains(updated, update.ID) {
+				updated = append(updated, update.ID)
+			}
+		}
+	}
+	return updated, nil
+}
+
+// The memory store is always reachable, it only fails once ctx is done
+func (store *MemoryStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (store *MemoryStore) Close() error {
+	return nil
+}
+
+// Builds the favorite returned to callers, it shares no memory with the store
+func (store *MemoryStore) toModel(favorite *memoryFavorite) models.Favorite {
+	asset := store.assets[favorite.assetID]
+	asset.Data = append([]byte(nil), asset.Data...)
+	if favorite.description != nil {
+		asset.Description = *favorite.description
+	}
+	return models.Favorite{Asset: asset, AddedAt: favorite.addedAt}
+}
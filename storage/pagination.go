@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions selects which favorites of a user are listed and in which order
+type ListOptions struct {
+	// Only favorites of these asset types, every type when empty
+	Types []models.AssetType
+
+	// Only audience favorites whose data passes every filter
+	Audience []AudienceFilter
+
+	// Only favorites whose description or text content match this web search style query
+	Search string
+
+	// Order of the favorites, see Order for the default
+	Sort []SortKey
+
+	PageSize int
+	// Page to return with offset pagination, ignored when After is set
+	Page int
+	// Keyset pagination, returns the favorites that come after this position
+	After *Cursor
+}
+
+// Cursor is the position of a favorite in the listing order.
+// It holds the value of every field favorites can be sorted by and the order it was created for.
+type Cursor struct {
+	AddedAt     time.Time `json:"t"`
+	AssetID     string    `json:"id"`
+	Type        string    `json:"ty,omitempty"`
+	Description string    `json:"d,omitempty"`
+	Rank        float32   `json:"r,omitempty"`
+	Sort        string    `json:"s,omitempty"`
+}
+
+// FavoritesPage is a page of favorites and the position of the next one
+type FavoritesPage struct {
+	Favorites []models.Favorite
+	HasMore   bool
+	// Position of the last favorite of the page, nil when the page is empty
+	Next *Cursor
+}
+
+// Returns the position of a favorite in the given order, as returned by ListOptions.Order
+func CursorOf(favorite models.Favorite, order []SortKey) *Cursor {
+	return &Cursor{
+		AddedAt:     favorite.AddedAt,
+		AssetID:     favorite.ID,
+		Type:        string(favorite.Type),
+		Description: favorite.Description,
+		Rank:        favorite.Rank,
+		Sort:        FormatSort(order),
+	}
+}
+
+// Tells whether the cursor was created for the given order
+func (c Cursor) Matches(order []SortKey) bool {
+	// Cursors created before sorting was added have no order
+	if c.Sort == "" {
+		return FormatSort(order) == FormatSort(ListOptions{}.Order())
+	}
+	return c.Sort == FormatSort(order)
+}
+
+// Checks that the options go together
+func (opts ListOptions) Validate() error {
+	for _, key := range opts.Sort {
+		if key.Field == SortByRelevance && opts.Search == "" {
+			return fmt.Errorf("%w: relevance needs a search query", ErrInvalidSort)
+		}
+	}
+	return nil
+}
+
+// Returns a favorite holding the sort values of the cursor
+func (c Cursor) favorite() models.Favorite {
+	return models.Favorite{
+		Asset:   models.Asset{ID: c.AssetID, Type: models.AssetType(c.Type), Description: c.Description},
+		AddedAt: c.AddedAt,
+		Rank:    c.Rank,
+	}
+}
+
+// Returns the opaque token handed to clients
+func (c Cursor) Encode() string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// Parses a token created by Cursor.Encode
+func DecodeCursor(token string) (*Cursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(payload, &cursor); err != nil || cursor.AssetID == "" || cursor.AddedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// Builds the page out of up to pageSize+1 favorites, the extra one only tells that there are more
+func newFavoritesPage(favorites []models.Favorite, opts ListOptions) FavoritesPage {
+	pageSize := opts.PageSize
+	page := FavoritesPage{Favorites: favorites}
+	if len(favorites) > pageSize {
+		page.Favorites = favorites[:pageSize]
+		page.HasMore = true
+	}
+	if len(page.Favorites) > 0 {
+		page.Next = CursorOf(page.Favorites[len(page.Favorites)-1], opts.Order())
+	}
+	return page
+}
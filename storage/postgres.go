@@ -1,27 +1,26 @@
 package storage
 
 import (
+	"context"
 	"fmt"
-	"time"
 
 	"github.com/arhsxro/platform-go-challenge/config"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
-// Creates a new db connection.
+// Creates a new db connection, with the pool sized as configured
 func NewPostgresDB(cfg *config.Config) (*sqlx.DB, error) {
-	connStr := fmt.Sprintf("user=%s dbname=%s password=%s host=%s port=%s sslmode=disable",
-		cfg.DBUsername, cfg.DBName, cfg.DBPassword, cfg.DBHost, cfg.DBPort)
+	connStr := fmt.Sprintf("user=%s dbname=%s password=%s host=%s port=%d sslmode=%s",
+		cfg.DBUsername, cfg.DBName, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBSSLMode)
 	db, err := sqlx.Connect("postgres", connStr)
 	if err != nil {
 		return nil, err
 	}
 
-	//These values can be set accordingly to the usecase in order to optimize resource usage
-	db.SetMaxOpenConns(20)
-	db.SetMaxIdleConns(2)
-	db.SetConnMaxLifetime(15 * time.Minute)
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
 
 	if err := db.Ping(); err != nil {
 		return nil, err
@@ -30,9 +29,18 @@ func NewPostgresDB(cfg *config.Config) (*sqlx.DB, error) {
 	return db, nil
 }
 
+func (store *PostgresStore) Ping(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
+
 func (store *PostgresStore) Close() error {
-	if store.db != nil {
+	if store.db.DB != nil {
 		return store.db.Close()
 	}
 	return nil
 }
+
+// Returns the underlying connection pool
+func (store *PostgresStore) DB() *sqlx.DB {
+	return store.db.DB
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/models"
+	"github.com/lib/pq"
+)
+
+// Last used times are only written once per interval, so that busy keys don't write on every request
+const apiKeyTouchInterval = time.Minute
+
+// Row of the api_keys table, the scopes are a postgres array
+type apiKeyRow struct {
+	models.APIKey
+	Scopes pq.StringArray `db:"scopes"`
+}
+
+func (row apiKeyRow) toModel() models.APIKey {
+	key := row.APIKey
+	key.Scopes = []string(row.Scopes)
+	return key
+}
+
+const apiKeyColumns = "key_id, name, secret_hash, scopes, created_at, expires_at, last_used_at, revoked_at"
+
+func (store *PostgresStore) CreateAPIKey(ctx context.Context, key models.APIKey) error {
+	query := "INSERT INTO api_keys (key_id, name, secret_hash, scopes, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	_, err := store.db.ExecContext(ctx, query, key.ID, key.Name, key.SecretHash, pq.Array(key.Scopes), key.CreatedAt, key.ExpiresAt)
+	return err
+}
+
+func (store *PostgresStore) GetAPIKey(ctx context.Context, id string) (models.APIKey, error) {
+	var row apiKeyRow
+	err := store.db.GetContext(ctx, &row, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_id = $1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, ErrNotFound
+	}
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	return row.toModel(), nil
+}
+
+// Lists every key, the most recently created first
+func (store *PostgresStore) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	var rows []apiKeyRow
+	if err := store.db.SelectContext(ctx, &rows, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at DESC, key_id"); err != nil {
+		return nil, err
+	}
+	keys := make([]models.APIKey, len(rows))
+	for i, row := range rows {
+		keys[i] = row.toModel()
+	}
+	return keys, nil
+}
+
+func (store *PostgresStore) RevokeAPIKey(ctx context.Context, id string) error {
+	result, err := store.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE key_id = $1", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *PostgresStore) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	query := "UPDATE api_keys SET last_used_at = $2 WHERE key_id = $1 AND (last_used_at IS NULL OR last_used_at < $3)"
+	_, err := store.db.ExecContext(ctx, query, id, usedAt, usedAt.Add(-apiKeyTouchInterval))
+	return err
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/arhsxro/platform-go-challenge/models"
+	"github.com/lib/pq"
+)
+
+// Expressions used when searching, they refer to the query joined as "query".
+// The document of a favorite has the description the user sees, its own or else the one of the catalog.
+// A favorite matches when its data or that description matches on its own, which the GIN index of each
+// document serves, and the whole document matches too, so that a word excluded from one is excluded from both.
+// The text of the snippet is HTML escaped before the matches are wrapped in <b></b>.
+const (
+	searchDocument  = "(a.data_search_document || COALESCE(f.search_document, a.description_search_document))"
+	searchPredicate = "(a.data_search_document @@ query OR f.search_document @@ query" +
+		" OR (f.description IS NULL AND a.description_search_document @@ query)) AND " + searchDocument + " @@ query"
+	rankColumn    = "ts_rank(" + searchDocument + ", query)"
+	snippetColumn = `ts_headline('english',
+            replace(replace(replace(replace(replace(
+                concat_ws(' ', COALESCE(f.description, a.description), a.data->>'title', a.data->>'axisTitle', a.data->>'text'),
+                '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;'),
+            query, 'StartSel=<b>, StopSel=</b>, MaxWords=20, MinWords=5')`
+)
+
+// favoritesQuery builds the queries over the favorites of a user out of the list options.
+// Every value is passed as a parameter, only allow-listed column names and operators are written in the SQL.
+type favoritesQuery struct {
+	columns    []string
+	from       string
+	conditions []string
+	args       []any
+}
+
+// Creates the query of the favorites of a user that match the filters of opts
+func newFavoritesQuery(userID string, opts ListOptions) (*favoritesQuery, error) {
+	if err := validateTypes(opts.Types); err != nil {
+		return nil, err
+	}
+
+	q := &favoritesQuery{
+		columns: []string{"a.asset_id", "a.type", "COALESCE(f.description, a.description) AS description", "a.data", "f.added_at"},
+		from:    "favorites f JOIN assets a ON a.asset_id = f.asset_id",
+	}
+	q.where("f.user_id = " + q.arg(userID))
+
+	if len(opts.Types) > 0 {
+		types := make([]string, len(opts.Types))
+		for i, assetType := range opts.Types {
+			types[i] = string(assetType)
+		}
+		q.where("a.type = ANY(" + q.arg(pq.Array(types)) + ")")
+	}
+
+	if len(opts.Audience) > 0 {
+		q.whereAudience(opts.Audience)
+	}
+
+	if opts.Search != "" {
+		q.from += " CROSS JOIN websearch_to_tsquery('english', " + q.arg(opts.Search) + ") AS query"
+		q.where(searchPredicate)
+		q.columns = append(q.columns, rankColumn+" AS rank", snippetColumn+" AS snippet")
+	}
+	return q, nil
+}
+
+// Adds a parameter and returns its placeholder
+func (q *favoritesQuery) arg(value any) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *favoritesQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// Returns the query of a page of favorites and its parameters
+func (q *favoritesQuery) page(opts ListOptions) (string, []any) {
+	order := opts.Order()
+	if opts.After != nil {
+		q.whereAfter(order, opts.After.favorite())
+	}
+
+	// One more row than the page size tells whether there is a next page
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT %s",
+		strings.Join(q.columns, ", "), q.from, strings.Join(q.conditions, " AND "), orderByClause(order), q.arg(opts.PageSize+1))
+	if opts.After == nil {
+		query += " OFFSET " + q.arg((opts.Page-1)*opts.PageSize)
+	}
+	return query, q.args
+}
+
+// Returns the query counting the favorites and its parameters
+func (q *favoritesQuery) count() (string, []any) {
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", q.from, strings.Join(q.conditions, " AND ")), q.args
+}
+
+// Builds the ORDER BY list of the sort keys, the columns come from the sortColumns allow-list
+func orderByClause(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = sortColumns[key.Field]
+		if key.Desc {
+			parts[i] += " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Selects the rows that come after the cursor in the given order
+func (q *favoritesQuery) whereAfter(keys []SortKey, cursor models.Favorite) {
+	placeholders := make([]string, len(keys))
+	columns := make([]string, len(keys))
+	sameDirection := true
+	for i, key := range keys {
+		placeholders[i] = q.arg(sortValue(cursor, key.Field))
+		columns[i] = sortColumns[key.Field]
+		sameDirection = sameDirection && key.Desc == keys[0].Desc
+	}
+
+	// A row comparison can use the listing index
+	if sameDirection {
+		operator := ">"
+		if keys[0].Desc {
+			operator = "<"
+		}
+		q.where(fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), operator, strings.Join(placeholders, ", ")))
+		return
+	}
+
+	// (k1 > v1) OR (k1 = v1 AND k2 < v2) OR ... with the operator of each key's direction
+	alternatives := make([]string, len(keys))
+	for i, key := range keys {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, columns[j]+" = "+placeholders[j])
+		}
+		operator := ">"
+		if key.Desc {
+			operator = "<"
+		}
+		terms = append(terms, columns[i]+" "+operator+" "+placeholders[i])
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+	q.where("(" + strings.Join(alternatives, " OR ") + ")")
+}
+
+// Adds the conditions of the audience filters, the equality filters of a field are alternatives.
+// A single value is a containment test and several values a jsonpath with one == per value, both of which the
+// GIN index of the asset data serves. The other operators are a jsonpath match the index can't serve, the
+// type condition narrows those down. The values are written in the jsonpath as escaped literals and the whole
+// jsonpath is passed as a parameter.
+func (q *favoritesQuery) whereAudience(filters []AudienceFilter) {
+	q.where("a.type = " + q.arg(models.AudienceType))
+	equal := equalValues(filters)
+	for _, filter := range filters {
+		if filter.Operator == OpEq {
+			values, ok := equal[filter.Field]
+			if !ok {
+				continue
+			}
+			delete(equal, filter.Field)
+			if len(values) == 1 {
+				document, _ := json.Marshal(map[AudienceField]any{filter.Field: values[0]})
+				q.where("a.data @> " + q.arg(string(document)) + "::jsonb")
+				continue
+			}
+			alternatives := make([]string, len(values))
+			for i, value := range values {
+				alternatives[i] = "@ == " + jsonpathLiteral(value)
+			}
+			path := fmt.Sprintf("$.%s ? (%s)", filter.Field, strings.Join(alternatives, " || "))
+			q.where("a.data @? " + q.arg(path) + "::jsonpath")
+			continue
+		}
+
+		// The field and the operator come from allow-lists
+		path := fmt.Sprintf("$.%s ? (@ %s %s)", filter.Field, filterOperators[filter.Operator], jsonpathLiteral(filter.Value))
+		q.where("a.data @? " + q.arg(path) + "::jsonpath")
+	}
+}
+
+// Writes the value of a filter as a jsonpath literal, strings are quoted and escaped like JSON strings
+func jsonpathLiteral(value any) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	literal, _ := json.Marshal(value)
+	return string(literal)
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhereAudience(t *testing.T) {
+	q, err := newFavoritesQuery("user1", ListOptions{Audience: []AudienceFilter{
+		{Field: AudienceGender, Operator: OpEq, Value: "Female"},
+		{Field: AudienceSocialMediaHours, Operator: OpGte, Value: 2.5},
+		{Field: AudienceBirthCountry, Operator: OpNe, Value: `Gre"ece) || (@ == 1`},
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"f.user_id = $1",
+		"a.type = $2",
+		"a.data @> $3::jsonb",
+		"a.data @? $4::jsonpath",
+		"a.data @? $5::jsonpath",
+	}, q.conditions)
+	assert.Equal(t, `{"gender":"Female"}`, q.args[2])
+	assert.Equal(t, `$.socialMediaHours ? (@ >= 2.5)`, q.args[3])
+	assert.Equal(t, `$.birthCountry ? (@ != "Gre\"ece) || (@ == 1")`, q.args[4], "the value is not escaped")
+}
+
+func TestWhereAudience_SeveralValues(t *testing.T) {
+	q, err := newFavoritesQuery("user1", ListOptions{Audience: []AudienceFilter{
+		{Field: AudienceGender, Operator: OpEq, Value: "Female"},
+		{Field: AudienceGender, Operator: OpEq, Value: "Male"},
+		{Field: AudienceSocialMediaHours, Operator: OpGte, Value: 2.0},
+		{Field: AudienceSocialMediaHours, Operator: OpLt, Value: 5.0},
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"f.user_id = $1",
+		"a.type = $2",
+		"a.data @? $3::jsonpath",
+		"a.data @? $4::jsonpath",
+		"a.data @? $5::jsonpath",
+	}, q.conditions)
+	assert.Equal(t, `$.gender ? (@ == "Female" || @ == "Male")`, q.args[2], "the values of a field are not alternatives")
+	assert.Equal(t, `$.socialMediaHours ? (@ >= 2)`, q.args[3])
+	assert.Equal(t, `$.socialMediaHours ? (@ < 5)`, q.args[4])
+}
@@ -2,27 +2,19 @@ package storage
 
 import (
 	"context"
-	"errors"
+	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/arhsxro/platform-go-challenge/config"
+	"github.com/arhsxro/platform-go-challenge/logging"
 	"github.com/arhsxro/platform-go-challenge/models"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresStore struct {
-	db *sqlx.DB
-}
-
-func isValidAssetType(paramType string) bool {
-	for _, validType := range models.ValidAssetTypes {
-		if models.AssetType(paramType) == validType {
-			return true
-		}
-	}
-	return false
+	db tracedDB
 }
 
 func NewPostgresStore(cfg *config.Config) (*PostgresStore, error) {
@@ -31,49 +23,85 @@ func NewPostgresStore(cfg *config.Config) (*PostgresStore, error) {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
-	return &PostgresStore{db: db}, nil
+	return &PostgresStore{db: tracedDB{db}}, nil
 }
 
-// Retrieves a user's favorite assets from the database
-func (store *PostgresStore) GetUserFavorites(ctx context.Context, userID, filterType string, page, pageSize int) ([]models.Asset, error) {
-
-	var assets []models.Asset
-	var query string
-	var err error
-	offset := (page - 1) * pageSize
-	if filterType != "" {
-		if !isValidAssetType(filterType) {
-			log.Println("Invalid asset type")
-			return nil, errors.New("invalid asset type")
-		}
-		query = "SELECT asset_id, type, description, data FROM assets WHERE user_id = $1 and type = $2 LIMIT $3 OFFSET $4"
-		err = store.db.SelectContext(ctx, &assets, query, userID, filterType, pageSize, offset)
-	} else {
-		query = "SELECT asset_id, type, description, data FROM assets WHERE user_id = $1 LIMIT $2 OFFSET $3"
-		err = store.db.SelectContext(ctx, &assets, query, userID, pageSize, offset)
+// Creates a store on top of an existing connection pool
+func NewPostgresStoreFromDB(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: tracedDB{db}}
+}
+
+// Retrieves a page of a user's favorite assets from the database
+func (store *PostgresStore) GetUserFavorites(ctx context.Context, userID string, opts ListOptions) (FavoritesPage, error) {
+	q, err := newFavoritesQuery(userID, opts)
+	if err != nil {
+		logging.FromContext(ctx).Info("invalid asset type", slog.Any("error", err))
+		return FavoritesPage{}, err
+	}
+
+	var favorites []models.Favorite
+	query, args := q.page(opts)
+	if err := store.db.SelectContext(ctx, &favorites, query, args...); err != nil {
+		return FavoritesPage{}, err
 	}
 
-	return assets, err
+	return newFavoritesPage(favorites, opts), nil
 }
 
-// Adds a new favorite asset for a user in the database
+// Counts the favorites of a user that match the filters of opts, pagination is ignored
+func (store *PostgresStore) CountUserFavorites(ctx context.Context, userID string, opts ListOptions) (int, error) {
+	q, err := newFavoritesQuery(userID, opts)
+	if err != nil {
+		logging.FromContext(ctx).Info("invalid asset type", slog.Any("error", err))
+		return 0, err
+	}
+
+	var count int
+	query, args := q.count()
+	err = store.db.GetContext(ctx, &count, query, args...)
+	return count, err
+}
+
+// Adds an asset to the favorites of a user in the database.
+// The asset is added to the catalog first if it is not already there.
 func (store *PostgresStore) AddFavorite(ctx context.Context, userID string, asset models.Asset) error {
-	tx, err := store.db.Begin() //begin transaction
+	tx, err := store.db.BeginTx(ctx, nil) //begin transaction
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	_, err = tx.ExecContext(ctx, "INSERT INTO users (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING", userID)
+	if err != nil {
+		return err
+	}
+
 	query := `
-        INSERT INTO assets (user_id, asset_id, type, description, data)
-        VALUES ($1, $2, $3, $4, $5)
+        INSERT INTO assets (asset_id, type, description, data)
+        VALUES ($1, $2, $3, $4)
         ON CONFLICT (asset_id) DO NOTHING`
 
-	_, err = tx.ExecContext(ctx, query, userID, asset.ID, asset.Type, asset.Description, string(asset.Data))
+	_, err = tx.ExecContext(ctx, query, asset.ID, asset.Type, asset.Description, string(asset.Data))
 	if err != nil {
 		return err
 	}
 
+	// The description is stored as a per-user override only when it differs from the catalog one
+	query = `
+        INSERT INTO favorites (user_id, asset_id, description)
+        SELECT $1, asset_id, NULLIF($3, description) FROM assets WHERE asset_id = $2
+        ON CONFLICT (user_id, asset_id) DO NOTHING`
+
+	result, err := tx.ExecContext(ctx, query, userID, asset.ID, asset.Description)
+	if err != nil {
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if inserted == 0 {
+		return ErrAlreadyExists
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
 		return err
@@ -82,19 +110,80 @@ func (store *PostgresStore) AddFavorite(ctx context.Context, userID string, asse
 	return nil
 }
 
-// Removes an asset from a user in the database
+// Adds a batch of assets to the favorites of a user in a single transaction, nothing is added when one of them fails.
+// The batch is passed as arrays so that the assets and the favorites are each inserted by one statement,
+// whatever the size of the batch. When an asset comes twice the first one wins, as with AddFavorite.
+func (store *PostgresStore) AddFavorites(ctx context.Context, userID string, assets []models.Asset) ([]string, error) {
+	added := []string{}
+	if len(assets) == 0 {
+		return added, nil
+	}
+	ids := make([]string, len(assets))
+	types := make([]string, len(assets))
+	descriptions := make([]string, len(assets))
+	data := make([]string, len(assets))
+	for i, asset := range assets {
+		ids[i], types[i], descriptions[i], data[i] = asset.ID, string(asset.Type), asset.Description, string(asset.Data)
+	}
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO users (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO assets (asset_id, type, description, data)
+        SELECT batch.asset_id, batch.type, batch.description, batch.data::jsonb
+        FROM unnest($1::text[], $2::text[], $3::text[], $4::text[]) WITH ORDINALITY AS batch(asset_id, type, description, data, position)
+        ORDER BY batch.position
+        ON CONFLICT (asset_id) DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(ids), pq.Array(types), pq.Array(descriptions), pq.Array(data))
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+        INSERT INTO favorites (user_id, asset_id, description)
+        SELECT $1, assets.asset_id, NULLIF(batch.description, assets.description)
+        FROM unnest($2::text[], $3::text[]) WITH ORDINALITY AS batch(asset_id, description, position)
+        JOIN assets ON assets.asset_id = batch.asset_id
+        ORDER BY batch.position
+        ON CONFLICT (user_id, asset_id) DO NOTHING
+        RETURNING asset_id`
+
+	if err := tx.SelectContext(ctx, &added, query, userID, pq.Array(ids), pq.Array(descriptions)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// Removes an asset from the favorites of a user in the database, the asset stays in the catalog
 func (store *PostgresStore) RemoveFavorite(ctx context.Context, userID, assetID string) error {
-	tx, err := store.db.Begin()
+	tx, err := store.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	query := "DELETE FROM assets WHERE user_id = $1 AND asset_id = $2"
-	_, err = store.db.ExecContext(ctx, query, userID, assetID)
+	query := "DELETE FROM favorites WHERE user_id = $1 AND asset_id = $2"
+	result, err := tx.ExecContext(ctx, query, userID, assetID)
 	if err != nil {
 		return err
 	}
+	if err := checkFound(result); err != nil {
+		return err
+	}
 
 	if err := tx.Commit(); err != nil {
 		return err
@@ -103,18 +192,21 @@ func (store *PostgresStore) RemoveFavorite(ctx context.Context, userID, assetID
 	return nil
 }
 
-// Updates an asset's description from a user in the database
+// Updates the description a user has for one of their favorite assets in the database
 func (store *PostgresStore) UpdateDescription(ctx context.Context, userID, assetID, newDescription string) error {
-	tx, err := store.db.Begin()
+	tx, err := store.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	query := "UPDATE assets SET description = $1 WHERE user_id = $2 AND asset_id = $3"
-	_, err = store.db.ExecContext(ctx, query, newDescription, userID, assetID)
+	query := "UPDATE favorites SET description = $1 WHERE user_id = $2 AND asset_id = $3"
+	result, err := tx.ExecContext(ctx, query, newDescription, userID, assetID)
 	if err != nil {
 		return err
 	}
+	if err := checkFound(result); err != nil {
+		return err
+	}
 
 	if err := tx.Commit(); err != nil {
 		return err
@@ -122,3 +214,69 @@ func (store *PostgresStore) UpdateDescription(ctx context.Context, userID, asset
 
 	return nil
 }
+
+// Returns ErrNotFound when the statement affected no favorite
+func checkFound(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Removes a batch of favorites of a user with a single statement, the assets stay in the catalog
+func (store *PostgresStore) RemoveFavorites(ctx context.Context, userID string, assetIDs []string) ([]string, error) {
+	removed := []string{}
+	if len(assetIDs) == 0 {
+		return removed, nil
+	}
+	query := "DELETE FROM favorites WHERE user_id = $1 AND asset_id = ANY($2::text[]) RETURNING asset_id"
+	if err := store.db.SelectContext(ctx, &removed, query, userID, pq.Array(assetIDs)); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// Updates the descriptions of a batch of favorites of a user with a single statement.
+// When an asset comes twice the last description wins, as if they were updated one after the other.
+func (store *PostgresStore) UpdateDescriptions(ctx context.Context, userID string, updates []models.DescriptionUpdate) ([]string, error) {
+	updated := []string{}
+	if len(updates) == 0 {
+		return updated, nil
+	}
+	updates = lastUpdates(updates)
+	ids := make([]string, len(updates))
+	descriptions := make([]string, len(updates))
+	for i, update := range updates {
+		ids[i], descriptions[i] = update.ID, update.Description
+	}
+
+	query := `
+        UPDATE favorites SET description = batch.description
+        FROM unnest($2::text[], $3::text[]) AS batch(asset_id, description)
+        WHERE favorites.user_id = $1 AND favorites.asset_id = batch.asset_id
+        RETURNING favorites.asset_id`
+
+	if err := store.db.SelectContext(ctx, &updated, query, userID, pq.Array(ids), pq.Array(descriptions)); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Keeps the last update of each asset, an UPDATE applies a single one of them
+func lastUpdates(updates []models.DescriptionUpdate) []models.DescriptionUpdate {
+	last := make(map[string]int, len(updates))
+	for i, update := range updates {
+		last[update.ID] = i
+	}
+	var kept []models.DescriptionUpdate
+	for i, update := range updates {
+		if last[update.ID] == i {
+			kept = append(kept, update)
+		}
+	}
+	return kept
+}
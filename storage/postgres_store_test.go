@@ -0,0 +1,153 @@
+//go:build postgres
+
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arhsxro/platform-go-challenge/migrations"
+	"github.com/arhsxro/platform-go-challenge/models"
+	"github.com/arhsxro/platform-go-challenge/storage"
+	"github.com/arhsxro/platform-go-challenge/storage/storagetest"
+)
+
+// Runs the storage suite against postgres, with go test -tags postgres ./storage.
+//
+// The tests use the database of STORAGE_TEST_POSTGRES_DSN when it is set, otherwise
+// they start an embedded postgres from the binaries cached in STORAGE_TEST_POSTGRES_CACHE
+// (default: the user cache directory). The binaries are only downloaded when
+// STORAGE_TEST_POSTGRES_FETCH is true, so the suite runs offline and fails when
+// neither a database nor the binaries are available.
+func TestPostgresStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the postgres tests in short mode")
+	}
+
+	db := openTestDatabase(t)
+	migrator, err := migrations.New(db)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up(context.Background()))
+	require.NoError(t, migrator.CheckApplied(context.Background()))
+
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		_, err := db.Exec("TRUNCATE favorites, assets, users, api_keys")
+		require.NoError(t, err)
+		return &unclosableStore{storage.NewPostgresStoreFromDB(db)}
+	})
+
+	// The suite can't make a statement of a batch fail after the ones before it succeeded, a trigger can
+	t.Run("AddFavoritesRollback", func(t *testing.T) {
+		_, err := db.Exec("TRUNCATE favorites, assets, users, api_keys")
+		require.NoError(t, err)
+		_, err = db.Exec(`
+            CREATE FUNCTION refuse_poisoned_favorite() RETURNS trigger AS $$
+            BEGIN
+                RAISE EXCEPTION 'poisoned favorite';
+            END $$ LANGUAGE plpgsql;
+            CREATE TRIGGER refuse_poisoned_favorite BEFORE INSERT ON favorites
+                FOR EACH ROW WHEN (NEW.asset_id = 'poisoned') EXECUTE FUNCTION refuse_poisoned_favorite();`)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := db.Exec("DROP TRIGGER refuse_poisoned_favorite ON favorites; DROP FUNCTION refuse_poisoned_favorite()")
+			require.NoError(t, err)
+		})
+
+		batch := []models.Asset{
+			{ID: "chart1", Type: models.ChartType, Description: "Chart", Data: json.RawMessage(`{"title": "A", "axisTitle": "Axis", "data": [1]}`)},
+			{ID: "poisoned", Type: models.InsightType, Description: "Insight", Data: json.RawMessage(`{"text": "B"}`)},
+		}
+		_, err = storage.NewPostgresStoreFromDB(db).AddFavorites(context.Background(), "user1", batch)
+		require.ErrorContains(t, err, "poisoned favorite")
+
+		// The user and the assets were inserted before the favorites failed
+		for _, table := range []string{"users", "assets", "favorites"} {
+			var count int
+			require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM "+table))
+			assert.Zero(t, count, "the rows the batch inserted in %s were not rolled back", table)
+		}
+	})
+}
+
+// The suite closes every store it creates while the pool is shared by all the tests
+type unclosableStore struct {
+	*storage.PostgresStore
+}
+
+func (s *unclosableStore) Close() error {
+	return nil
+}
+
+func openTestDatabase(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv("STORAGE_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		dsn = startEmbeddedPostgres(t)
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func startEmbeddedPostgres(t *testing.T) string {
+	t.Helper()
+
+	cachePath := os.Getenv("STORAGE_TEST_POSTGRES_CACHE")
+	if cachePath == "" {
+		userCache, err := os.UserCacheDir()
+		require.NoError(t, err, "no cache directory for the embedded postgres binaries, set STORAGE_TEST_POSTGRES_CACHE")
+		cachePath = filepath.Join(userCache, "embedded-postgres-go")
+	}
+
+	version := embeddedpostgres.V13
+	archives, err := filepath.Glob(filepath.Join(cachePath, fmt.Sprintf("embedded-postgres-binaries-*-%s.txz", version)))
+	require.NoError(t, err)
+	if len(archives) == 0 && os.Getenv("STORAGE_TEST_POSTGRES_FETCH") != "true" {
+		t.Fatalf("no postgres %s binaries in %s: set STORAGE_TEST_POSTGRES_DSN to use an existing database "+
+			"or run once with STORAGE_TEST_POSTGRES_FETCH=true to download them", version, cachePath)
+	}
+
+	port := freePort(t)
+	runtimePath := t.TempDir()
+	postgres := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+		Version(version).
+		Port(port).
+		CachePath(cachePath).
+		RuntimePath(runtimePath).
+		BinariesPath(filepath.Join(cachePath, "binaries")).
+		DataPath(filepath.Join(runtimePath, "data")).
+		Logger(nil))
+
+	// initdb refuses to run as root
+	if err := postgres.Start(); err != nil {
+		t.Fatalf("could not start an embedded postgres, set STORAGE_TEST_POSTGRES_DSN to use an existing one: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := postgres.Stop(); err != nil {
+			t.Errorf("failed to stop the embedded postgres: %v", err)
+		}
+	})
+
+	return fmt.Sprintf("host=localhost port=%d user=postgres password=postgres dbname=postgres sslmode=disable", port)
+}
+
+func freePort(t *testing.T) uint32 {
+	t.Helper()
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return uint32(listener.Addr().(*net.TCPAddr).Port)
+}
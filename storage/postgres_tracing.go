@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/arhsxro/platform-go-challenge/tracing"
+	"github.com/jmoiron/sqlx"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedDB is the pool of PostgresStore, every statement it runs gets a span
+type tracedDB struct {
+	*sqlx.DB
+}
+
+func (db tracedDB) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	ctx, span := startQuerySpan(ctx, query)
+	err := db.DB.SelectContext(ctx, dest, query, args...)
+	tracing.End(span, err)
+	return err
+}
+
+func (db tracedDB) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	ctx, span := startQuerySpan(ctx, query)
+	err := db.DB.GetContext(ctx, dest, query, args...)
+	// Finding no row is an answer, not a failure
+	if errors.Is(err, sql.ErrNoRows) {
+		span.End()
+		return err
+	}
+	tracing.End(span, err)
+	return err
+}
+
+func (db tracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+// Begins a transaction, the time spent waiting for a connection of the pool shows up in its span
+func (db tracedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*tracedTx, error) {
+	spanCtx, span := startQuerySpan(ctx, "BEGIN")
+	tx, err := db.DB.BeginTxx(spanCtx, opts)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, ctx: ctx}, nil
+}
+
+// tracedTx is a transaction whose statements get a span
+type tracedTx struct {
+	*sqlx.Tx
+	// Context the transaction was begun with, the spans of the commit and the rollback are siblings of its statements
+	ctx context.Context
+	// Whether the transaction was committed or rolled back, the deferred rollback after a commit gets no span
+	done bool
+}
+
+func (tx *tracedTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	result, err := tx.Tx.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (tx *tracedTx) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	ctx, span := startQuerySpan(ctx, query)
+	err := tx.Tx.SelectContext(ctx, dest, query, args...)
+	tracing.End(span, err)
+	return err
+}
+
+func (tx *tracedTx) Commit() error {
+	_, span := startQuerySpan(tx.ctx, "COMMIT")
+	err := tx.Tx.Commit()
+	tx.done = true
+	tracing.End(span, err)
+	return err
+}
+
+func (tx *tracedTx) Rollback() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	_, span := startQuerySpan(tx.ctx, "ROLLBACK")
+	err := tx.Tx.Rollback()
+	tx.done = true
+	// A canceled context already rolled the transaction back
+	if errors.Is(err, sql.ErrTxDone) {
+		span.End()
+		return err
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// Starts the span of a statement, named after its operation. The statement is sanitized
+// so that no value ends up in the traces, even when it is written in the SQL itself.
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	statement := sanitizeSQL(query)
+	operation, _, _ := strings.Cut(statement, " ")
+	operation = strings.ToUpper(operation)
+	return tracing.Tracer().Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(operation), semconv.DBStatement(statement)),
+	)
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^$\w.])\d+(?:\.\d+)?\b`)
+)
+
+// Replaces the literals of a statement with ? and collapses its whitespace,
+// the $n placeholders are kept since the values they stand for are not in the statement
+func sanitizeSQL(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = numericLiteral.ReplaceAllString(query, "${1}?")
+	return strings.Join(strings.Fields(query), " ")
+}
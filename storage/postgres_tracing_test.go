@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM favorites WHERE user_id = $1 LIMIT $2":        "SELECT * FROM favorites WHERE user_id = $1 LIMIT $2",
+		"SELECT * FROM favorites WHERE user_id = 'user1' LIMIT 10":   "SELECT * FROM favorites WHERE user_id = ? LIMIT ?",
+		"UPDATE assets SET description = 'it''s' WHERE id = 1.5":     "UPDATE assets SET description = ? WHERE id = ?",
+		"\n        INSERT INTO users (user_id)\n        VALUES ($1)": "INSERT INTO users (user_id) VALUES ($1)",
+		"SELECT a.data2, count(*)::double precision FROM t2":         "SELECT a.data2, count(*)::double precision FROM t2",
+	}
+	for query, expected := range tests {
+		assert.Equal(t, expected, sanitizeSQL(query), query)
+	}
+}
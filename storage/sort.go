@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/models"
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+// SortField is a field favorites can be sorted by
+type SortField string
+
+const (
+	SortByAddedAt     SortField = "added_at"
+	SortByType        SortField = "type"
+	SortByDescription SortField = "description"
+	SortByAssetID     SortField = "asset_id"
+	// Only when searching, how well favorites match the search
+	SortByRelevance SortField = "relevance"
+)
+
+// The fields that can be sorted by and the SQL expression of each.
+// Text is compared byte by byte so postgres and the memory store agree on the order.
+var sortColumns = map[SortField]string{
+	SortByAddedAt:     "f.added_at",
+	SortByType:        `a.type COLLATE "C"`,
+	SortByDescription: `COALESCE(f.description, a.description) COLLATE "C"`,
+	SortByAssetID:     `f.asset_id COLLATE "C"`,
+	SortByRelevance:   rankColumn,
+}
+
+// SortKey is one level of the listing order
+type SortKey struct {
+	Field SortField
+	Desc  bool
+}
+
+// Parses a comma separated list of sort fields, a leading "-" sorts by the field in descending order.
+// For example "-added_at,type" sorts by most recently added, then by type.
+func ParseSort(value string) ([]SortKey, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var keys []SortKey
+	seen := make(map[SortField]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		key := SortKey{}
+		if name, ok := strings.CutPrefix(part, "-"); ok {
+			key.Desc = true
+			part = name
+		} else {
+			part = strings.TrimPrefix(part, "+")
+		}
+		key.Field = SortField(part)
+
+		if _, ok := sortColumns[key.Field]; !ok {
+			return nil, fmt.Errorf("%w: unknown field %q, expected one of added_at, type, description, asset_id, relevance", ErrInvalidSort, part)
+		}
+		if seen[key.Field] {
+			return nil, fmt.Errorf("%w: field %q is used twice", ErrInvalidSort, part)
+		}
+		seen[key.Field] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Formats sort keys the way ParseSort reads them
+func FormatSort(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = string(key.Field)
+		if key.Desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Returns the order favorites are actually listed in.
+// Without an explicit order search results come by relevance and other listings by added time.
+// The asset id always comes last as a tie breaker, so that the order is total and cursors are stable.
+func (opts ListOptions) Order() []SortKey {
+	keys := opts.Sort
+	if len(keys) == 0 {
+		keys = []SortKey{{Field: SortByAddedAt}}
+		if opts.Search != "" {
+			keys = []SortKey{{Field: SortByRelevance, Desc: true}}
+		}
+	}
+	for _, key := range keys {
+		if key.Field == SortByAssetID {
+			return keys
+		}
+	}
+	return append(append([]SortKey(nil), keys...), SortKey{Field: SortByAssetID})
+}
+
+// Returns the value of a sort field of a favorite
+func sortValue(favorite models.Favorite, field SortField) any {
+	switch field {
+	case SortByAddedAt:
+		return favorite.AddedAt
+	case SortByType:
+		return string(favorite.Type)
+	case SortByDescription:
+		return favorite.Description
+	case SortByRelevance:
+		return favorite.Rank
+	default:
+		return favorite.ID
+	}
+}
+
+// Compares two favorites in the given order, returns a negative number when a comes first
+func compareFavorites(a, b models.Favorite, keys []SortKey) int {
+	for _, key := range keys {
+		var result int
+		switch valueA := sortValue(a, key.Field).(type) {
+		case time.Time:
+			result = valueA.Compare(sortValue(b, key.Field).(time.Time))
+		case string:
+			result = strings.Compare(valueA, sortValue(b, key.Field).(string))
+		case float32:
+			result = cmp.Compare(valueA, sortValue(b, key.Field).(float32))
+		}
+		if key.Desc {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return 0
+}
@@ -0,0 +1,824 @@
+// Package storagetest holds the behavioral test suite that every storage.Store
+// implementation must pass, so that all the backends behave the same way.
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arhsxro/platform-go-challenge/models"
+	"github.com/arhsxro/platform-go-challenge/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty store, it is called once per test of the suite
+type Factory func(t *testing.T) storage.Store
+
+// Runs the whole suite against the stores created by newStore
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store storage.Store)
+	}{
+		{"Ping", testPing},
+		{"EmptyFavorites", testEmptyFavorites},
+		{"AddAndGetFavorite", testAddAndGetFavorite},
+		{"PaginationBoundaries", testPaginationBoundaries},
+		{"KeysetPagination", testKeysetPagination},
+		{"KeysetPaginationAfterRemoval", testKeysetPaginationAfterRemoval},
+		{"Sort", testSort},
+		{"KeysetPaginationWithSort", testKeysetPaginationWithSort},
+		{"TypeFiltering", testTypeFiltering},
+		{"MultipleTypesFiltering", testMultipleTypesFiltering},
+		{"InvalidTypeFilter", testInvalidTypeFilter},
+		{"AudienceFiltering", testAudienceFiltering},
+		{"CountFavorites", testCountFavorites},
+		{"Search", testSearch},
+		{"SearchRelevance", testSearchRelevance},
+		{"SearchSnippetEscaped", testSearchSnippetEscaped},
+		{"KeysetPaginationWithSearch", testKeysetPaginationWithSearch},
+		{"DuplicateAdd", testDuplicateAdd},
+		{"AddFavoritesBatch", testAddFavoritesBatch},
+		{"AddFavoritesCanceled", testAddFavoritesCanceled},
+		{"AddFavoritesRollback", testAddFavoritesRollback},
+		{"SharedAsset", testSharedAsset},
+		{"RemoveFavorite", testRemoveFavorite},
+		{"RemoveMissingFavorite", testRemoveMissingFavorite},
+		{"UpdateDescription", testUpdateDescription},
+		{"UpdateDescriptionOfAnotherUser", testUpdateDescriptionOfAnotherUser},
+		{"RemoveFavoritesBatch", testRemoveFavoritesBatch},
+		{"UpdateDescriptionsBatch", testUpdateDescriptionsBatch},
+		{"ConcurrentWriters", testConcurrentWriters},
+		{"APIKeys", testAPIKeys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore(t)
+			t.Cleanup(func() { store.Close() })
+			tt.test(t, store)
+		})
+	}
+}
+
+func insight(id, text string) models.Asset {
+	return models.Asset{ID: id, Type: models.InsightType, Description: "Insight " + id, Data: json.RawMessage(fmt.Sprintf(`{"text": %q}`, text))}
+}
+
+func chart(id, title string) models.Asset {
+	return models.Asset{ID: id, Type: models.ChartType, Description: "Chart " + id, Data: json.RawMessage(fmt.Sprintf(`{"title": %q, "axisTitle": "Axis", "data": [1, 2, 3]}`, title))}
+}
+
+func audience(id, gender string) models.Asset {
+	return models.Asset{ID: id, Type: models.AudienceType, Description: "Audience " + id, Data: json.RawMessage(fmt.Sprintf(`{"gender": %q, "birthCountry": "Greece", "ageGroup": "24-35", "socialMediaHours": 3, "purchasesLastMonth": 6}`, gender))}
+}
+
+func addFavorites(t *testing.T, store storage.Store, userID string, assets ...models.Asset) {
+	t.Helper()
+	for _, asset := range assets {
+		require.NoError(t, store.AddFavorite(context.Background(), userID, asset))
+	}
+}
+
+// Adds the favorites with distinct added times, for tests that depend on the order they were added in
+func addFavoritesInOrder(t *testing.T, store storage.Store, userID string, assets ...models.Asset) {
+	t.Helper()
+	for _, asset := range assets {
+		addFavorites(t, store, userID, asset)
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Returns every favorite of the user in a single page
+func allFavorites(t *testing.T, store storage.Store, userID string) []models.Favorite {
+	t.Helper()
+	page, err := store.GetUserFavorites(context.Background(), userID, storage.ListOptions{Page: 1, PageSize: 1000})
+	require.NoError(t, err)
+	return page.Favorites
+}
+
+func ids(favorites []models.Favorite) []string {
+	ids := make([]string, len(favorites))
+	for i, favorite := range favorites {
+		ids[i] = favorite.ID
+	}
+	return ids
+}
+
+func findFavorite(favorites []models.Favorite, assetID string) (models.Favorite, bool) {
+	for _, favorite := range favorites {
+		if favorite.ID == assetID {
+			return favorite, true
+		}
+	}
+	return models.Favorite{}, false
+}
+
+func testPing(t *testing.T, store storage.Store) {
+	require.NoError(t, store.Ping(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, store.Ping(ctx))
+}
+
+func testEmptyFavorites(t *testing.T, store storage.Store) {
+	page, err := store.GetUserFavorites(context.Background(), "nobody", storage.ListOptions{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Favorites)
+	assert.False(t, page.HasMore)
+}
+
+func testAddAndGetFavorite(t *testing.T, store storage.Store) {
+	asset := chart("chart1", "Test Chart")
+	addFavorites(t, store, "user1", asset)
+
+	favorites := allFavorites(t, store, "user1")
+	require.Len(t, favorites, 1)
+	assert.Equal(t, asset.ID, favorites[0].ID)
+	assert.Equal(t, asset.Type, favorites[0].Type)
+	assert.Equal(t, asset.Description, favorites[0].Description)
+	assert.JSONEq(t, string(asset.Data), string(favorites[0].Data))
+	assert.False(t, favorites[0].AddedAt.IsZero(), "added_at is not set")
+}
+
+func testPaginationBoundaries(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		addFavorites(t, store, "user1", insight(fmt.Sprintf("insight%d", i), "text"))
+	}
+
+	expected := []struct {
+		page    int
+		ids     []string
+		hasMore bool
+	}{
+		{1, []string{"insight1", "insight2"}, true},
+		{2, []string{"insight3", "insight4"}, true},
+		{3, []string{"insight5"}, false},
+		{4, []string{}, false},
+	}
+	for _, tt := range expected {
+		page, err := store.GetUserFavorites(ctx, "user1", storage.ListOptions{Page: tt.page, PageSize: 2})
+		require.NoError(t, err)
+		assert.Equal(t, tt.ids, ids(page.Favorites), "page %d", tt.page)
+		assert.Equal(t, tt.hasMore, page.HasMore, "page %d", tt.page)
+	}
+
+	page, err := store.GetUserFavorites(ctx, "user1", storage.ListOptions{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Favorites, 5, "a page larger than the favorites returns all of them")
+	assert.False(t, page.HasMore)
+
+	page, err = store.GetUserFavorites(ctx, "user1", storage.ListOptions{Page: 1, PageSize: 5})
+	require.NoError(t, err)
+	assert.Len(t, page.Favorites, 5)
+	assert.False(t, page.HasMore, "a page holding exactly the remaining favorites has no next page")
+
+	page, err = store.GetUserFavorites(ctx, "user1", storage.ListOptions{Page: 5, PageSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"insight5"}, ids(page.Favorites), "the last favorite is on the last page")
+}
+
+func testKeysetPagination(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		addFavorites(t, store, "user1", insight(fmt.Sprintf("insight%d", i), "text"), chart(fmt.Sprintf("chart%d", i), "title"))
+	}
+
+	// Walking the pages with the cursor returns every favorite once, in the listing order
+	var walked []string
+	opts := storage.ListOptions{Types: []models.AssetType{models.InsightType}, Page: 1, PageSize: 2}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5, "the cursor does not advance")
+		page, err := store.GetUserFavorites(ctx, "user1", opts)
+		require.NoError(t, err)
+		walked = append(walked, ids(page.Favorites)...)
+		if !page.HasMore {
+			break
+		}
+		require.NotNil(t, page.Next)
+		opts.After = page.Next
+	}
+	assert.Equal(t, []string{"insight1", "insight2", "insight3", "insight4", "insight5"}, walked)
+
+	// The cursor of the last favorite returns an empty page
+	last := allFavorites(t, store, "user1")
+	page, err := store.GetUserFavorites(ctx, "user1", storage.ListOptions{PageSize: 2, After: storage.CursorOf(last[len(last)-1], storage.ListOptions{}.Order())})
+	require.NoError(t, err)
+	assert.Empty(t, page.Favorites)
+	assert.False(t, page.HasMore)
+
+	// A cursor survives its encoding
+	decoded, err := storage.DecodeCursor(storage.CursorOf(last[0], storage.ListOptions{}.Order()).Encode())
+	require.NoError(t, err)
+	page, err = store.GetUserFavorites(ctx, "user1", storage.ListOptions{PageSize: 1, After: decoded})
+	require.NoError(t, err)
+	assert.Equal(t, []string{last[1].ID}, ids(page.Favorites))
+}
+
+func testKeysetPaginationAfterRemoval(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	for i := 1; i <= 4; i++ {
+		addFavorites(t, store, "user1", insight(fmt.Sprintf("insight%d", i), "text"))
+	}
+
+	page, err := store.GetUserFavorites(ctx, "user1", storage.ListOptions{PageSize: 2, Page: 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"insight1", "insight2"}, ids(page.Favorites))
+
+	// The favorite the cursor points to is gone, the next page is still right
+	require.NoError(t, store.RemoveFavorite(ctx, "user1", "insight2"))
+	page, err = store.GetUserFavorites(ctx, "user1", storage.ListOptions{PageSize: 2, After: page.Next})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"insight3", "insight4"}, ids(page.Favorites))
+}
+
+func testSort(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavoritesInOrder(t, store, "user1", insight("b", "text"), chart("a", "title"), audience("c", "Male"), chart("d", "title"))
+	require.NoError(t, store.UpdateDescription(ctx, "user1", "d", "A chart"))
+
+	tests := []struct {
+		sort string
+		ids  []string
+	}{
+		{"", []string{"b", "a", "c", "d"}},
+		{"-added_at", []string{"d", "c", "a", "b"}},
+		{"asset_id", []string{"a", "b", "c", "d"}},
+		{"-asset_id", []string{"d", "c", "b", "a"}},
+		{"description", []string{"d", "c", "a", "b"}},
+		{"type", []string{"c", "a", "d", "b"}},
+		{"type,-added_at", []string{"c", "d", "a", "b"}},
+		{"-type,-asset_id", []string{"b", "d", "a", "c"}},
+	}
+	for _, tt := range tests {
+		keys, err := storage.ParseSort(tt.sort)
+		require.NoError(t, err)
+		page, err := store.GetUserFavorites(ctx, "user1", storage.ListOptions{Sort: keys, Page: 1, PageSize: 10})
+		require.NoError(t, err)
+		assert.Equal(t, tt.ids, ids(page.Favorites), "sort %q", tt.sort)
+	}
+}
+
+func testKeysetPaginationWithSort(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1",
+		chart("chart1", "A"), insight("insight1", "B"), chart("chart2", "C"),
+		audience("audience1", "Male"), insight("insight2", "D"), chart("chart3", "E"))
+
+	for _, sort := range []string{"type,-added_at", "-type,description", "-description,-asset_id", "-added_at"} {
+		keys, err := storage.ParseSort(sort)
+		require.NoError(t, err)
+
+		page, err := store.GetUserFavorites(ctx, "user1", storage.ListOptions{Sort: keys, Page: 1, PageSize: 10})
+		require.NoError(t, err)
+		expected := ids(page.Favorites)
+
+		var walked []string
+		opts := storage.ListOptions{Sort: keys, Page: 1, PageSize: 4}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 6, "the cursor does not advance with sort %q", sort)
+			page, err := store.GetUserFavorites(ctx, "user1", opts)
+			require.NoError(t, err)
+			walked = append(walked, ids(page.Favorites)...)
+			if !page.HasMore {
+				break
+			}
+			opts.PageSize = 1
+			opts.After = page.Next
+		}
+		assert.Equal(t, expected, walked, "sort %q", sort)
+	}
+}
+
+func testTypeFiltering(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1", chart("chart1", "A"), insight("insight1", "B"), audience("audience1", "Male"), chart("chart2", "C"))
+	addFavorites(t, store, "user2", chart("chart3", "D"))
+
+	expected := map[models.AssetType][]string{
+		models.ChartType:    {"chart1", "chart2"},
+		models.InsightType:  {"insight1"},
+		models.AudienceType: {"audience1"},
+	}
+	for assetType, expectedIDs := range expected {
+		page, err := store.GetUserFavorites(ctx, "user1", storage.ListOptions{Types: []models.AssetType{assetType}, Page: 1, PageSize: 10})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expectedIDs, ids(page.Favorites), "type %s", assetType)
+	}
+}
+
+func testMultipleTypesFiltering(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavoritesInOrder(t, store, "user1",
+		chart("chart1", "Sales by region"),
+		insight("insight1", "Sales grow in summer"),
+		audience("audience1", "Male"),
+		chart("chart2", "Costs by region"),
+	)
+
+	types := []models.AssetType{models.ChartType, models.InsightType}
+	page, err := store.GetUserFavorites(ctx, "user1", storage.ListOptions{Types: types, Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"chart1", "insight1", "chart2"}, ids(page.Favorites))
+
+	// Together with search and sort
+	sort, err := storage.ParseSort("-asset_id")
+	require.NoError(t, err)
+	opts := storage.ListOptions{Types: types, Search: "sales", Sort: sort, Page: 1, PageSize: 10}
+	page, err = store.GetUserFavorites(ctx, "user1", opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"insight1", "chart1"}, ids(page.Favorites))
+
+	count, err := store.CountUserFavorites(ctx, "user1", opts)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// One invalid type fails the whole listing
+	_, err = store.GetUserFavorites(ctx, "user1", storage.ListOptions{Types: []models.AssetType{models.ChartType, "Map"}, Page: 1, PageSize: 10})
+	assert.Error(t, err)
+}
+
+func testInvalidTypeFilter(t *testing.T, store storage.Store) {
+	addFavorites(t, store, "user1", chart("chart1", "A"))
+
+	_, err := store.GetUserFavorites(context.Background(), "user1", storage.ListOptions{Types: []models.AssetType{"Map"}, Page: 1, PageSize: 10})
+	assert.ErrorIs(t, err, storage.ErrInvalidAssetType)
+	_, err = store.CountUserFavorites(context.Background(), "user1", storage.ListOptions{Types: []models.AssetType{"Map"}})
+	assert.ErrorIs(t, err, storage.ErrInvalidAssetType)
+}
+
+func testAudienceFiltering(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	heavyUser := audience("audience2", "Female")
+	heavyUser.Data = json.RawMessage(`{"gender": "Female", "birthCountry": "Italy", "ageGroup": "18-24", "socialMediaHours": 5.5, "purchasesLastMonth": 2}`)
+	addFavorites(t, store, "user1", audience("audience1", "Male"), heavyUser, audience("audience3", "Female"), chart("chart1", "Gender split"))
+	addFavorites(t, store, "user2", audience("audience4", "Female"))
+
+	tests := []struct {
+		filters  []storage.AudienceFilter
+		expected []string
+	}{
+		{[]storage.AudienceFilter{{Field: storage.AudienceGender, Operator: storage.OpEq, Value: "Female"}}, []string{"audience2", "audience3"}},
+		{[]storage.AudienceFilter{{Field: storage.AudienceGender, Operator: storage.OpNe, Value: "Female"}}, []string{"audience1"}},
+		{[]storage.AudienceFilter{{Field: storage.AudienceSocialMediaHours, Operator: storage.OpGte, Value: 3.0}}, []string{"audience1", "audience2", "audience3"}},
+		{[]storage.AudienceFilter{{Field: storage.AudienceSocialMediaHours, Operator: storage.OpGt, Value: 3.0}}, []string{"audience2"}},
+		{[]storage.AudienceFilter{{Field: storage.AudiencePurchasesLastMonth, Operator: storage.OpLt, Value: 6.0}}, []string{"audience2"}},
+		{[]storage.AudienceFilter{{Field: storage.AudiencePurchasesLastMonth, Operator: storage.OpEq, Value: 6.0}}, []string{"audience1", "audience3"}},
+		{[]storage.AudienceFilter{
+			{Field: storage.AudienceGender, Operator: storage.OpEq, Value: "Female"},
+			{Field: storage.AudienceBirthCountry, Operator: storage.OpEq, Value: "Greece"},
+			{Field: storage.AudienceSocialMediaHours, Operator: storage.OpLte, Value: 3.0},
+		}, []string{"audience3"}},
+		{[]storage.AudienceFilter{{Field: storage.AudienceAgeGroup, Operator: storage.OpEq, Value: "65+"}}, nil},
+		// The values of a field are alternatives, the other operators all apply
+		{[]storage.AudienceFilter{
+			{Field: storage.AudienceGender, Operator: storage.OpEq, Value: "Male"},
+			{Field: storage.AudienceGender, Operator: storage.OpEq, Value: "Female"},
+		}, []string{"audience1", "audience2", "audience3"}},
+		{[]storage.AudienceFilter{
+			{Field: storage.AudienceGender, Operator: storage.OpEq, Value: "Male"},
+			{Field: storage.AudienceGender, Operator: storage.OpEq, Value: "Female"},
+			{Field: storage.AudienceBirthCountry, Operator: storage.OpEq, Value: "Italy"},
+		}, []string{"audience2"}},
+		{[]storage.AudienceFilter{
+			{Field: storage.AudienceSocialMediaHours, Operator: storage.OpGte, Value: 3.0},
+			{Field: storage.AudienceSocialMediaHours, Operator: storage.OpLt, Value: 5.0},
+		}, []string{"audience1", "audience3"}},
+	}
+	for _, tt := range tests {
+		opts := storage.ListOptions{Audience: tt.filters, Page: 1, PageSize: 10}
+		page, err := store.GetUserFavorites(ctx, "user1", opts)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, tt.expected, ids(page.Favorites), "filters %v", tt.filters)
+
+		count, err := store.CountUserFavorites(ctx, "user1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, len(tt.expected), count, "filters %v", tt.filters)
+	}
+}
+
+func testCountFavorites(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1", chart("chart1", "A"), insight("insight1", "B"), chart("chart2", "C"))
+	addFavorites(t, store, "user2", chart("chart1", "A"))
+
+	count, err := store.CountUserFavorites(ctx, "user1", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// Pagination does not change the count
+	count, err = store.CountUserFavorites(ctx, "user1", storage.ListOptions{Types: []models.AssetType{models.ChartType}, Page: 2, PageSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = store.CountUserFavorites(ctx, "nobody", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	_, err = store.CountUserFavorites(ctx, "user1", storage.ListOptions{Types: []models.AssetType{"Map"}})
+	assert.Error(t, err)
+}
+
+func testSearch(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1",
+		chart("chart1", "Quarterly revenue"),
+		insight("insight1", "Customers churn after the trial"),
+		insight("insight2", "Revenue grows with the trial length"),
+	)
+	addFavorites(t, store, "user2", chart("chart2", "Revenue per region"))
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"revenue", []string{"chart1", "insight2"}},
+		{"REVENUE trial", []string{"insight2"}},
+		{"trial -revenue", []string{"insight1"}},
+		// The words must all be in the data or all in the description
+		{"insight trial", nil},
+		{"forecast", nil},
+	}
+	for _, tt := range tests {
+		opts := storage.ListOptions{Search: tt.query, Page: 1, PageSize: 10}
+		page, err := store.GetUserFavorites(ctx, "user1", opts)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, tt.expected, ids(page.Favorites), "query %q", tt.query)
+
+		count, err := store.CountUserFavorites(ctx, "user1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, len(tt.expected), count, "query %q", tt.query)
+	}
+
+	// The description a user gave is searched as well
+	require.NoError(t, store.UpdateDescription(ctx, "user1", "insight1", "Onboarding funnel"))
+	page, err := store.GetUserFavorites(ctx, "user1", storage.ListOptions{Search: "onboarding", Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	require.Equal(t, []string{"insight1"}, ids(page.Favorites))
+	assert.Contains(t, page.Favorites[0].Snippet, "<b>")
+	assert.Positive(t, page.Favorites[0].Rank)
+
+	// and replaces the description of the catalog, which the other users still find
+	page, err = store.GetUserFavorites(ctx, "user1", storage.ListOptions{Search: "insight1", Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Favorites, "the catalog description of a favorite with its own description was searched")
+	addFavorites(t, store, "user2", insight("insight1", "Customers churn after the trial"))
+	page, err = store.GetUserFavorites(ctx, "user2", storage.ListOptions{Search: "insight1", Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"insight1"}, ids(page.Favorites))
+}
+
+func testSearchSnippetEscaped(t *testing.T, store storage.Store) {
+	addFavorites(t, store, "user1", insight("insight1", `<img src=x onerror="alert(1)"> revenue`))
+
+	page, err := store.GetUserFavorites(context.Background(), "user1", storage.ListOptions{Search: "revenue", Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Favorites, 1)
+	assert.Contains(t, page.Favorites[0].Snippet, "<b>revenue</b>")
+	assert.NotContains(t, page.Favorites[0].Snippet, "<img")
+	assert.Contains(t, page.Favorites[0].Snippet, "&lt;img")
+}
+
+func testSearchRelevance(t *testing.T, store storage.Store) {
+	addFavoritesInOrder(t, store, "user1",
+		insight("insight1", "Churn is low"),
+		insight("insight2", "Churn churn churn everywhere"),
+		insight("insight3", "Nothing to see"),
+	)
+
+	page, err := store.GetUserFavorites(context.Background(), "user1", storage.ListOptions{Search: "churn", Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"insight2", "insight1"}, ids(page.Favorites), "best matches do not come first")
+}
+
+func testKeysetPaginationWithSearch(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavoritesInOrder(t, store, "user1",
+		insight("insight1", "Revenue"),
+		insight("insight2", "Revenue and revenue again"),
+		insight("insight3", "Costs"),
+		chart("chart1", "Revenue by month"),
+		chart("chart2", "Revenue by year"),
+	)
+
+	for _, sort := range []string{"", "-relevance", "relevance,-added_at", "type"} {
+		keys, err := storage.ParseSort(sort)
+		require.NoError(t, err)
+		opts := storage.ListOptions{Search: "revenue", Sort: keys, Page: 1, PageSize: 10}
+
+		page, err := store.GetUserFavorites(ctx, "user1", opts)
+		require.NoError(t, err)
+		expected := ids(page.Favorites)
+		require.Len(t, expected, 4, "sort %q", sort)
+
+		var walked []string
+		opts.PageSize = 1
+		for range expected {
+			page, err := store.GetUserFavorites(ctx, "user1", opts)
+			require.NoError(t, err)
+			walked = append(walked, ids(page.Favorites)...)
+			if !page.HasMore {
+				break
+			}
+			opts.After = page.Next
+		}
+		assert.Equal(t, expected, walked, "sort %q", sort)
+	}
+}
+
+func testDuplicateAdd(t *testing.T, store storage.Store) {
+	asset := insight("insight1", "text")
+	addFavorites(t, store, "user1", asset)
+
+	duplicate := asset
+	duplicate.Description = "Another description"
+	assert.ErrorIs(t, store.AddFavorite(context.Background(), "user1", duplicate), storage.ErrAlreadyExists)
+
+	favorites := allFavorites(t, store, "user1")
+	require.Len(t, favorites, 1)
+	assert.Equal(t, asset.Description, favorites[0].Description, "adding a favorite twice changed it")
+}
+
+func testAddFavoritesBatch(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1", insight("insight1", "text"))
+	addFavorites(t, store, "user2", chart("chart1", "Shared"))
+
+	withOwnDescription := chart("chart1", "Shared")
+	withOwnDescription.Description = "My chart"
+	duplicate := audience("audience1", "Female")
+	duplicate.Description = "Second one"
+	batch := []models.Asset{
+		withOwnDescription,
+		audience("audience1", "Female"),
+		insight("insight1", "text"),
+		duplicate,
+	}
+	added, err := store.AddFavorites(ctx, "user1", batch)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"chart1", "audience1"}, added, "the favorites the user already had are not added again")
+	added, err = store.AddFavorites(ctx, "user1", nil)
+	require.NoError(t, err)
+	assert.Empty(t, added)
+
+	favorites := allFavorites(t, store, "user1")
+	assert.ElementsMatch(t, []string{"insight1", "chart1", "audience1"}, ids(favorites))
+	shared, ok := findFavorite(favorites, "chart1")
+	require.True(t, ok)
+	assert.Equal(t, "My chart", shared.Description)
+	first, ok := findFavorite(favorites, "audience1")
+	require.True(t, ok)
+	assert.Equal(t, "Audience audience1", first.Description, "the first of the duplicates of a batch is kept")
+	assert.Equal(t, []string{"chart1"}, ids(allFavorites(t, store, "user2")), "a batch affected another user")
+}
+
+func testAddFavoritesCanceled(t *testing.T, store storage.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := store.AddFavorites(ctx, "user1", []models.Asset{chart("chart1", "A"), insight("insight1", "B")})
+	assert.Error(t, err)
+	assert.Empty(t, allFavorites(t, store, "user1"), "a failed batch added favorites")
+}
+
+// A batch with an asset the store refuses adds none of them, neither to the favorites nor to the catalog.
+// Postgres refuses it with the statement inserting every asset, the tests of the postgres store
+// make a later statement of a batch fail.
+func testAddFavoritesRollback(t *testing.T, store storage.Store) {
+	broken := insight("insight1", "B")
+	broken.Data = json.RawMessage(`{"text": `)
+	_, err := store.AddFavorites(context.Background(), "user1", []models.Asset{chart("chart1", "A"), broken})
+	require.Error(t, err)
+	assert.Empty(t, allFavorites(t, store, "user1"), "a batch that failed midway added favorites")
+
+	// Had the batch added chart1 to the catalog, its data would be the one of the batch
+	addFavorites(t, store, "user2", chart("chart1", "Another title"))
+	favorites := allFavorites(t, store, "user2")
+	require.Len(t, favorites, 1)
+	assert.JSONEq(t, string(chart("chart1", "Another title").Data), string(favorites[0].Data), "a batch that failed midway added assets to the catalog")
+}
+
+func testSharedAsset(t *testing.T, store storage.Store) {
+	asset := chart("chart1", "Test Chart")
+	addFavorites(t, store, "user1", asset)
+
+	withOwnDescription := asset
+	withOwnDescription.Description = "My chart"
+	addFavorites(t, store, "user2", withOwnDescription)
+
+	user1Favorites := allFavorites(t, store, "user1")
+	require.Len(t, user1Favorites, 1)
+	assert.Equal(t, asset.Description, user1Favorites[0].Description)
+
+	user2Favorites := allFavorites(t, store, "user2")
+	require.Len(t, user2Favorites, 1)
+	assert.Equal(t, "My chart", user2Favorites[0].Description)
+	assert.JSONEq(t, string(asset.Data), string(user2Favorites[0].Data))
+}
+
+func testRemoveFavorite(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1", chart("chart1", "A"), insight("insight1", "B"))
+	addFavorites(t, store, "user2", chart("chart1", "A"))
+
+	require.NoError(t, store.RemoveFavorite(ctx, "user1", "chart1"))
+
+	assert.Equal(t, []string{"insight1"}, ids(allFavorites(t, store, "user1")))
+	assert.Equal(t, []string{"chart1"}, ids(allFavorites(t, store, "user2")), "removing a favorite affected another user")
+
+	// The asset stays in the catalog and can be favorited again
+	addFavorites(t, store, "user1", chart("chart1", "A"))
+	assert.ElementsMatch(t, []string{"chart1", "insight1"}, ids(allFavorites(t, store, "user1")))
+}
+
+func testRemoveMissingFavorite(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1", chart("chart1", "A"))
+
+	assert.ErrorIs(t, store.RemoveFavorite(ctx, "user1", "missing"), storage.ErrNotFound)
+	assert.ErrorIs(t, store.RemoveFavorite(ctx, "nobody", "chart1"), storage.ErrNotFound)
+	assert.Equal(t, []string{"chart1"}, ids(allFavorites(t, store, "user1")))
+}
+
+func testUpdateDescription(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1", chart("chart1", "A"), insight("insight1", "B"))
+
+	require.NoError(t, store.UpdateDescription(ctx, "user1", "chart1", "Updated description"))
+
+	favorites := allFavorites(t, store, "user1")
+	updated, ok := findFavorite(favorites, "chart1")
+	require.True(t, ok)
+	assert.Equal(t, "Updated description", updated.Description)
+	untouched, ok := findFavorite(favorites, "insight1")
+	require.True(t, ok)
+	assert.Equal(t, "Insight insight1", untouched.Description)
+}
+
+func testUpdateDescriptionOfAnotherUser(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1", chart("chart1", "A"))
+
+	assert.ErrorIs(t, store.UpdateDescription(ctx, "user2", "chart1", "Not mine"), storage.ErrNotFound)
+	assert.ErrorIs(t, store.UpdateDescription(ctx, "user1", "missing", "Missing"), storage.ErrNotFound)
+
+	favorites := allFavorites(t, store, "user1")
+	require.Len(t, favorites, 1)
+	assert.Equal(t, "Chart chart1", favorites[0].Description, "a user changed the description of another user's favorite")
+	assert.Empty(t, allFavorites(t, store, "user2"), "updating a description added a favorite")
+}
+
+func testRemoveFavoritesBatch(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1", chart("chart1", "A"), insight("insight1", "B"), insight("insight2", "C"))
+	addFavorites(t, store, "user2", chart("chart1", "A"), insight("insight3", "D"))
+
+	removed, err := store.RemoveFavorites(ctx, "user1", []string{"chart1", "insight2", "insight3", "missing", "chart1"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"chart1", "insight2"}, removed, "only the favorites of the user are removed, once")
+
+	assert.Equal(t, []string{"insight1"}, ids(allFavorites(t, store, "user1")))
+	assert.ElementsMatch(t, []string{"chart1", "insight3"}, ids(allFavorites(t, store, "user2")), "removing favorites affected another user")
+
+	removed, err = store.RemoveFavorites(ctx, "user1", nil)
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+}
+
+func testUpdateDescriptionsBatch(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	addFavorites(t, store, "user1", chart("chart1", "A"), insight("insight1", "B"), insight("insight2", "C"))
+	addFavorites(t, store, "user2", insight("insight3", "D"))
+
+	updated, err := store.UpdateDescriptions(ctx, "user1", []models.DescriptionUpdate{
+		{ID: "chart1", Description: "First"},
+		{ID: "insight1", Description: "My insight"},
+		{ID: "insight3", Description: "Not mine"},
+		{ID: "chart1", Description: "My chart"},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"chart1", "insight1"}, updated)
+
+	favorites := allFavorites(t, store, "user1")
+	for id, description := range map[string]string{"chart1": "My chart", "insight1": "My insight", "insight2": "Insight insight2"} {
+		favorite, ok := findFavorite(favorites, id)
+		require.True(t, ok)
+		assert.Equal(t, description, favorite.Description, id)
+	}
+	assert.Equal(t, "Insight insight3", allFavorites(t, store, "user2")[0].Description, "a user changed the description of another user's favorite")
+}
+
+func testConcurrentWriters(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+	const writers = 10
+	const assetsPerWriter = 5
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, writers*assetsPerWriter*3)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("user%d", w%2)
+			for i := 0; i < assetsPerWriter; i++ {
+				// Every writer also adds the same shared asset, only the first one of each user adds it
+				if err := store.AddFavorite(ctx, userID, chart("shared", "Shared")); err != nil && !errors.Is(err, storage.ErrAlreadyExists) {
+					errCh <- err
+				}
+				assetID := fmt.Sprintf("insight-%d-%d", w, i)
+				if err := store.AddFavorite(ctx, userID, insight(assetID, "text")); err != nil {
+					errCh <- err
+				}
+				if err := store.UpdateDescription(ctx, userID, assetID, "Updated "+assetID); err != nil {
+					errCh <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		assert.NoError(t, err)
+	}
+
+	for u := 0; u < 2; u++ {
+		userID := fmt.Sprintf("user%d", u)
+		favorites := allFavorites(t, store, userID)
+		assert.Len(t, favorites, writers/2*assetsPerWriter+1, "user %s", userID)
+		for _, favorite := range favorites {
+			if favorite.ID != "shared" {
+				assert.Equal(t, "Updated "+favorite.ID, favorite.Description)
+			}
+		}
+	}
+}
+
+func testAPIKeys(t *testing.T, store storage.Store) {
+	keys, ok := store.(storage.APIKeyStore)
+	if !ok {
+		t.Skip("the store does not keep api keys")
+	}
+	ctx := context.Background()
+
+	createdAt := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := createdAt.Add(24 * time.Hour)
+	first := models.APIKey{ID: "key1", Name: "nightly export", Scopes: []string{"favorites:read"}, SecretHash: "hash1", CreatedAt: createdAt, ExpiresAt: &expiresAt}
+	second := models.APIKey{ID: "key2", Name: "importer", Scopes: []string{"favorites:read", "favorites:write"}, SecretHash: "hash2", CreatedAt: createdAt.Add(time.Hour)}
+	require.NoError(t, keys.CreateAPIKey(ctx, first))
+	require.NoError(t, keys.CreateAPIKey(ctx, second))
+	assert.Error(t, keys.CreateAPIKey(ctx, first), "a key id was reused")
+
+	key, err := keys.GetAPIKey(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "nightly export", key.Name)
+	assert.Equal(t, []string{"favorites:read"}, key.Scopes)
+	assert.Equal(t, "hash1", key.SecretHash)
+	assert.True(t, createdAt.Equal(key.CreatedAt))
+	require.NotNil(t, key.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*key.ExpiresAt))
+	assert.Nil(t, key.LastUsedAt)
+	assert.Nil(t, key.RevokedAt)
+
+	_, err = keys.GetAPIKey(ctx, "missing")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	list, err := keys.ListAPIKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "key2", list[0].ID, "the most recently created key does not come first")
+
+	// Uses within a minute of each other are recorded once
+	usedAt := time.Now().UTC().Truncate(time.Microsecond)
+	require.NoError(t, keys.TouchAPIKey(ctx, "key1", usedAt))
+	require.NoError(t, keys.TouchAPIKey(ctx, "key1", usedAt.Add(time.Second)))
+	key, err = keys.GetAPIKey(ctx, "key1")
+	require.NoError(t, err)
+	require.NotNil(t, key.LastUsedAt)
+	assert.True(t, usedAt.Equal(*key.LastUsedAt))
+
+	require.NoError(t, keys.TouchAPIKey(ctx, "key1", usedAt.Add(2*time.Minute)))
+	key, err = keys.GetAPIKey(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, usedAt.Add(2*time.Minute).Equal(*key.LastUsedAt))
+
+	require.NoError(t, keys.RevokeAPIKey(ctx, "key1"))
+	key, err = keys.GetAPIKey(ctx, "key1")
+	require.NoError(t, err)
+	require.NotNil(t, key.RevokedAt)
+	revokedAt := *key.RevokedAt
+
+	require.NoError(t, keys.RevokeAPIKey(ctx, "key1"))
+	key, err = keys.GetAPIKey(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, revokedAt.Equal(*key.RevokedAt), "revoking twice moved the revocation time")
+
+	assert.ErrorIs(t, keys.RevokeAPIKey(ctx, "missing"), storage.ErrNotFound)
+}
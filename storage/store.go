@@ -2,15 +2,50 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/arhsxro/platform-go-challenge/models"
 )
 
+var (
+	// The favorite or the API key does not exist
+	ErrNotFound = errors.New("not found")
+	// The favorite is already among the ones of the user
+	ErrAlreadyExists = errors.New("already exists")
+	// A type filter names a type that is not one of models.ValidAssetTypes
+	ErrInvalidAssetType = errors.New("invalid asset type")
+)
+
 // Signatures of the operations that can be perfomred on the db
 type Store interface {
-	GetUserFavorites(ctx context.Context, userID, filterType string, page, pageSize int) ([]models.Asset, error)
+	GetUserFavorites(ctx context.Context, userID string, opts ListOptions) (FavoritesPage, error)
+	CountUserFavorites(ctx context.Context, userID string, opts ListOptions) (int, error)
+	// Returns ErrAlreadyExists when the user already has the asset among their favorites, the favorite is left as it is
 	AddFavorite(ctx context.Context, userID string, asset models.Asset) error
+	// Adds a batch of assets in a single transaction, none of them is added when one fails.
+	// It returns the ids of the assets that were added, the others already were favorites of the user.
+	AddFavorites(ctx context.Context, userID string, assets []models.Asset) ([]string, error)
+	// Both return ErrNotFound when the asset is not among the favorites of the user
 	RemoveFavorite(ctx context.Context, userID, assetID string) error
 	UpdateDescription(ctx context.Context, userID, assetID, newDescription string) error
+	// Remove a batch of favorites and update the descriptions of a batch of them, each with a single statement.
+	// They return the ids of the favorites that were removed or updated, the others are not favorites of the user.
+	RemoveFavorites(ctx context.Context, userID string, assetIDs []string) ([]string, error)
+	UpdateDescriptions(ctx context.Context, userID string, updates []models.DescriptionUpdate) ([]string, error)
+	// Checks that the store can serve requests, for the readiness probe
+	Ping(ctx context.Context) error
 	Close() error
 }
+
+// APIKeyStore keeps the API keys of the services calling the API
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key models.APIKey) error
+	// Returns ErrNotFound when there is no key with this id, revoked and expired keys are returned as well
+	GetAPIKey(ctx context.Context, id string) (models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	// Returns ErrNotFound when there is no key with this id, revoking a key twice keeps the first revocation time
+	RevokeAPIKey(ctx context.Context, id string) error
+	// Records that the key was used
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// Executor runs the items of a batch concurrently, at most Concurrency of them at a time
+type Executor struct {
+	Concurrency int
+}
+
+// Runs task for each of the n items of a batch and returns the error of each item, in order.
+// Once ctx is done the items still queued are not run, their error is the one of ctx.
+func (e Executor) Run(ctx context.Context, n int, task func(ctx context.Context, i int) error) []error {
+	concurrency := e.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	errs := make([]error, n)
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		// Both cases may be ready, the queued items are dropped whichever was picked
+		if err := ctx.Err(); err != nil {
+			for ; i < n; i++ {
+				errs[i] = err
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			errs[i] = task(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutor_Concurrency(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	var mu sync.Mutex
+	var ran []int
+	errs := Executor{Concurrency: 3}.Run(context.Background(), 20, func(ctx context.Context, i int) error {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := maxRunning.Load()
+			if current <= previous || maxRunning.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		ran = append(ran, i)
+		mu.Unlock()
+		if i == 7 {
+			return errors.New("item 7 failed")
+		}
+		return nil
+	})
+
+	assert.LessOrEqual(t, maxRunning.Load(), int32(3))
+	assert.Len(t, ran, 20)
+	assert.Len(t, errs, 20)
+	for i, err := range errs {
+		if i == 7 {
+			assert.EqualError(t, err, "item 7 failed")
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestExecutor_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var ran atomic.Int32
+	errs := Executor{Concurrency: 2}.Run(ctx, 10, func(ctx context.Context, i int) error {
+		ran.Add(1)
+		if i == 1 {
+			cancel()
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	// The two running items see the cancellation and the queued ones never run
+	assert.Equal(t, int32(2), ran.Load())
+	for _, err := range errs {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
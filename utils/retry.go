@@ -2,32 +2,81 @@ package utils
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"time"
+
+	"github.com/arhsxro/platform-go-challenge/logging"
+	"github.com/arhsxro/platform-go-challenge/metrics"
+	"github.com/arhsxro/platform-go-challenge/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// Retry function with exponential backoff
-func RetryWithExponentialBackoff(ctx context.Context, operation func() error) error {
-	const maxAttempts = 3
+// RetryPolicy tells how many times an operation is attempted and how long to wait after each failure,
+// the wait grows by Backoff with every attempt
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Second}
+
+// Retry function with exponential backoff, following the default policy
+func RetryWithExponentialBackoff(ctx context.Context, operation func(ctx context.Context) error) error {
+	return DefaultRetryPolicy.Retry(ctx, operation)
+}
+
+// Wraps an error that retrying won't fix, such as one telling that the request itself is wrong
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Marks err as not worth retrying, Retry returns it right away, unwrapped
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Retries the operation until it succeeds, fails with a Permanent error, ctx is done or the attempts run out.
+// Each attempt gets its own span, the operation is given its context so that its spans are children of it.
+func (policy RetryPolicy) Retry(ctx context.Context, operation func(ctx context.Context) error) error {
 	var err error
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		err = operation()
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		attemptCtx, span := tracing.Tracer().Start(ctx, "retry attempt")
+		span.SetAttributes(attribute.Int("retry.attempt", attempt+1))
+		err = operation(attemptCtx)
+		tracing.End(span, err)
 		if err == nil {
+			metrics.ObserveRetry(attempt+1, "success")
 			return nil
 		}
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			metrics.ObserveRetry(attempt+1, "permanent")
+			return permanent.err
+		}
 
 		if ctx.Err() != nil {
+			metrics.ObserveRetry(attempt+1, "canceled")
 			return ctx.Err()
 		}
+		logging.FromContext(ctx).Debug("attempt failed", slog.Int("attempt", attempt+1), slog.Any("error", err))
 
-		backoff := time.Duration(attempt) * time.Second
+		backoff := time.Duration(attempt) * policy.Backoff
 
 		select {
 		case <-ctx.Done():
+			metrics.ObserveRetry(attempt+1, "canceled")
 			return ctx.Err()
 		case <-time.After(backoff):
 		}
 	}
-	log.Println("Reached all the retry attemps ")
+	metrics.ObserveRetry(policy.MaxAttempts, "error")
+	logging.FromContext(ctx).Warn("reached all the retry attempts", slog.Int("attempts", policy.MaxAttempts), slog.Any("error", err))
 	return err
 }
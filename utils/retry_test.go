@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry_Permanent(t *testing.T) {
+	notFound := errors.New("not found")
+	attempts := 0
+	err := RetryPolicy{MaxAttempts: 3}.Retry(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return Permanent(notFound)
+	})
+
+	assert.Equal(t, notFound, err, "the error is returned unwrapped")
+	assert.Equal(t, 1, attempts)
+
+	attempts = 0
+	err = RetryPolicy{MaxAttempts: 3}.Retry(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return notFound
+	})
+	assert.Equal(t, notFound, err)
+	assert.Equal(t, 3, attempts)
+}